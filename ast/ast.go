@@ -2,6 +2,8 @@ package ast
 
 import (
 	"bytes"
+	"math/big"
+	"strconv"
 	"strings"
 
 	"github.com/tysufa/qfa/token"
@@ -28,12 +30,14 @@ func (p *Program) String() string {
 type Statement interface {
 	Node
 	TokenLiteral() string
+	GetToken() token.Token
 	StatementNode()
 }
 
 type Expression interface {
 	Node
 	TokenLiteral() string
+	GetToken() token.Token
 	ExpressionNode()
 }
 
@@ -43,8 +47,9 @@ type CallExpression struct {
 	Arguments []Expression
 }
 
-func (ce *CallExpression) TokenLiteral() string { return ce.TokenLiteral() }
-func (ce *CallExpression) ExpressionNode()      {}
+func (ce *CallExpression) TokenLiteral() string  { return ce.Token.Value }
+func (ce *CallExpression) GetToken() token.Token { return ce.Token }
+func (ce *CallExpression) ExpressionNode()       {}
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -64,12 +69,14 @@ func (ce *CallExpression) String() string {
 
 type FunctionLiteral struct {
 	Token      token.Token
+	Name       string // name of the variable the function is bound to, empty if anonymous
 	Parameters []*Identifier
 	Body       BlockStatement
 }
 
-func (fl *FunctionLiteral) TokenLiteral() string { return fl.TokenLiteral() }
-func (fl *FunctionLiteral) ExpressionNode()      {}
+func (fl *FunctionLiteral) TokenLiteral() string  { return fl.Token.Value }
+func (fl *FunctionLiteral) GetToken() token.Token { return fl.Token }
+func (fl *FunctionLiteral) ExpressionNode()       {}
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
@@ -88,41 +95,179 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
-type WhileStatement struct{
-  Token token.Token
-  Condition Expression
-  Instructions *BlockStatement
+type WhileStatement struct {
+	Token        token.Token
+	Condition    Expression
+	Instructions *BlockStatement
 }
 
-func (ws WhileStatement) TokenLiteral() string { return ws.Token.Value }
-func (ws WhileStatement) StatementNode()       {}
-func (ws WhileStatement) String() string       {return ""}
+func (ws WhileStatement) TokenLiteral() string  { return ws.Token.Value }
+func (ws WhileStatement) GetToken() token.Token { return ws.Token }
+func (ws WhileStatement) StatementNode()        {}
+func (ws WhileStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString("{")
+	out.WriteString(ws.Instructions.String())
+	out.WriteString("}")
+	return out.String()
+}
+
+// ForStatement is for (Init; Condition; Update) { Body }, the parts left out
+// are nil. The variable declared by Init only exists in the loop
+type ForStatement struct {
+	Token     token.Token
+	Init      Statement
+	Condition Expression
+	Update    Statement
+	Body      *BlockStatement
+}
+
+func (fs *ForStatement) TokenLiteral() string  { return fs.Token.Value }
+func (fs *ForStatement) GetToken() token.Token { return fs.Token }
+func (fs *ForStatement) StatementNode()        {}
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("for(")
+	if fs.Init != nil {
+		out.WriteString(strings.TrimSuffix(fs.Init.String(), ";"))
+	}
+	out.WriteString(";")
+	if fs.Condition != nil {
+		out.WriteString(fs.Condition.String())
+	}
+	out.WriteString(";")
+	if fs.Update != nil {
+		out.WriteString(strings.TrimSuffix(fs.Update.String(), ";"))
+	}
+	out.WriteString("){" + fs.Body.String() + "}")
+	return out.String()
+}
+
+// ForInStatement is for (x in Iterable) { Body } or for (k, v in Iterable) { Body },
+// the Variables only exist in the body, see object.Iterate
+type ForInStatement struct {
+	Token     token.Token
+	Variables []*Identifier // one or two
+	Iterable  Expression
+	Body      *BlockStatement
+}
+
+func (fs *ForInStatement) TokenLiteral() string  { return fs.Token.Value }
+func (fs *ForInStatement) GetToken() token.Token { return fs.Token }
+func (fs *ForInStatement) StatementNode()        {}
+func (fs *ForInStatement) String() string {
+	variables := []string{}
+	for _, v := range fs.Variables {
+		variables = append(variables, v.String())
+	}
+	return "for(" + strings.Join(variables, ", ") + " in " + fs.Iterable.String() + "){" + fs.Body.String() + "}"
+}
+
+type BreakStatement struct {
+	Token token.Token
+}
+
+func (bs *BreakStatement) TokenLiteral() string  { return bs.Token.Value }
+func (bs *BreakStatement) GetToken() token.Token { return bs.Token }
+func (bs *BreakStatement) StatementNode()        {}
+func (bs *BreakStatement) String() string        { return "break;" }
+
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (cs *ContinueStatement) TokenLiteral() string  { return cs.Token.Value }
+func (cs *ContinueStatement) GetToken() token.Token { return cs.Token }
+func (cs *ContinueStatement) StatementNode()        {}
+func (cs *ContinueStatement) String() string        { return "continue;" }
+
+type ThrowStatement struct {
+	Token token.Token
+	Value Expression
+}
+
+func (ts *ThrowStatement) TokenLiteral() string  { return ts.Token.Value }
+func (ts *ThrowStatement) GetToken() token.Token { return ts.Token }
+func (ts *ThrowStatement) StatementNode()        {}
+func (ts *ThrowStatement) String() string        { return "throw " + ts.Value.String() + ";" }
+
+// TryStatement needs a catch block, a finally block or both, Catch and Finally
+// are nil when they are omitted
+type TryStatement struct {
+	Token      token.Token
+	Body       *BlockStatement
+	CatchParam *Identifier // name the caught error is bound to
+	Catch      *BlockStatement
+	Finally    *BlockStatement
+}
+
+func (ts *TryStatement) TokenLiteral() string  { return ts.Token.Value }
+func (ts *TryStatement) GetToken() token.Token { return ts.Token }
+func (ts *TryStatement) StatementNode()        {}
+func (ts *TryStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("try{" + ts.Body.String() + "}")
+	if ts.Catch != nil {
+		out.WriteString("catch(" + ts.CatchParam.String() + "){" + ts.Catch.String() + "}")
+	}
+	if ts.Finally != nil {
+		out.WriteString("finally{" + ts.Finally.String() + "}")
+	}
+	return out.String()
+}
+
+type PrintStatement struct {
+	Token     token.Token
+	Arguments []Expression
+}
+
+func (ps *PrintStatement) TokenLiteral() string  { return ps.Token.Value }
+func (ps *PrintStatement) GetToken() token.Token { return ps.Token }
+func (ps *PrintStatement) StatementNode()        {}
+func (ps *PrintStatement) String() string {
+	args := []string{}
+	for _, a := range ps.Arguments {
+		args = append(args, a.String())
+	}
+	return "print(" + strings.Join(args, ", ") + ");"
+}
 
 type ReturnStatement struct {
 	Token token.Token
 	Value Expression
 }
 
-func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Value }
-func (rs *ReturnStatement) StatementNode()       {}
-func (rs *ReturnStatement) String() string       { return "return " + rs.Value.String() }
+func (rs *ReturnStatement) TokenLiteral() string  { return rs.Token.Value }
+func (rs *ReturnStatement) GetToken() token.Token { return rs.Token }
+func (rs *ReturnStatement) StatementNode()        {}
+func (rs *ReturnStatement) String() string        { return "return " + rs.Value.String() }
 
+// Identifier is given by the resolver the slot of the variable it names: when
+// it is Local, Index in the scope Depth levels above the one it appears in,
+// otherwise Index in the globals
 type Identifier struct {
 	Token token.Token
 	Value string
+	Local bool
+	Depth int
+	Index int
 }
 
-func (i *Identifier) TokenLiteral() string { return i.Token.Value }
-func (i *Identifier) ExpressionNode()      {}
-func (i *Identifier) String() string       { return i.Value }
+func (i *Identifier) TokenLiteral() string  { return i.Token.Value }
+func (i *Identifier) GetToken() token.Token { return i.Token }
+func (i *Identifier) ExpressionNode()       {}
+func (i *Identifier) String() string        { return i.Value }
 
 type ExpressionStatement struct {
 	Token      token.Token
 	Expression Expression
 }
 
-func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Value }
-func (es *ExpressionStatement) StatementNode()       {}
+func (es *ExpressionStatement) TokenLiteral() string  { return es.Token.Value }
+func (es *ExpressionStatement) GetToken() token.Token { return es.Token }
+func (es *ExpressionStatement) StatementNode()        {}
 func (es *ExpressionStatement) String() string {
 	return es.Expression.String()
 }
@@ -134,21 +279,46 @@ type InfixExpression struct {
 	Right    Expression
 }
 
-func (is *InfixExpression) TokenLiteral() string { return is.Token.Value }
-func (is *InfixExpression) ExpressionNode()      {}
+func (is *InfixExpression) TokenLiteral() string  { return is.Token.Value }
+func (is *InfixExpression) GetToken() token.Token { return is.Token }
+func (is *InfixExpression) ExpressionNode()       {}
 func (is *InfixExpression) String() string {
+	if is.Operator == "in" {
+		return "(" + is.Left.String() + " in " + is.Right.String() + ")"
+	}
 	res := "(" + is.Left.String() + is.Operator + is.Right.String() + ")"
 	return res
 }
 
+// RangeExpression is Start..End or Start..=End, followed by step Step
+type RangeExpression struct {
+	Token     token.Token // .. or ..= token
+	Start     Expression
+	End       Expression
+	Step      Expression // nil if not given, the step is then 1
+	Inclusive bool
+}
+
+func (re *RangeExpression) TokenLiteral() string  { return re.Token.Value }
+func (re *RangeExpression) GetToken() token.Token { return re.Token }
+func (re *RangeExpression) ExpressionNode()       {}
+func (re *RangeExpression) String() string {
+	res := "(" + re.Start.String() + re.Token.Value + re.End.String()
+	if re.Step != nil {
+		res += " step " + re.Step.String()
+	}
+	return res + ")"
+}
+
 type PrefixExpression struct {
 	Token    token.Token
 	Operator string
 	Right    Expression
 }
 
-func (ps *PrefixExpression) TokenLiteral() string { return ps.Token.Value }
-func (ps *PrefixExpression) ExpressionNode()      {}
+func (ps *PrefixExpression) TokenLiteral() string  { return ps.Token.Value }
+func (ps *PrefixExpression) GetToken() token.Token { return ps.Token }
+func (ps *PrefixExpression) ExpressionNode()       {}
 func (ps *PrefixExpression) String() string {
 	res := "(" + ps.Operator + ps.Right.String() + ")"
 	return res
@@ -159,29 +329,130 @@ type Boolean struct {
 	Value bool
 }
 
-func (b *Boolean) TokenLiteral() string { return b.Token.Value }
-func (b *Boolean) ExpressionNode()      {}
+func (b *Boolean) TokenLiteral() string  { return b.Token.Value }
+func (b *Boolean) GetToken() token.Token { return b.Token }
+func (b *Boolean) ExpressionNode()       {}
 func (b *Boolean) String() string {
 	return b.Token.Value
 }
 
+// IntegerLiteral holds literals too large for an int in Big
 type IntegerLiteral struct {
 	Token token.Token
 	Value int
+	Big   *big.Int
 }
 
-func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Value }
-func (il *IntegerLiteral) ExpressionNode()      {}
+func (il *IntegerLiteral) TokenLiteral() string  { return il.Token.Value }
+func (il *IntegerLiteral) GetToken() token.Token { return il.Token }
+func (il *IntegerLiteral) ExpressionNode()       {}
 func (il *IntegerLiteral) String() string {
 	return il.Token.Value
 }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) TokenLiteral() string  { return fl.Token.Value }
+func (fl *FloatLiteral) GetToken() token.Token { return fl.Token }
+func (fl *FloatLiteral) ExpressionNode()       {}
+func (fl *FloatLiteral) String() string {
+	return fl.Token.Value
+}
+
+type StringLiteral struct {
+	Token token.Token
+	Value string
+}
+
+func (sl *StringLiteral) TokenLiteral() string  { return sl.Token.Value }
+func (sl *StringLiteral) GetToken() token.Token { return sl.Token }
+func (sl *StringLiteral) ExpressionNode()       {}
+func (sl *StringLiteral) String() string {
+	return strconv.Quote(sl.Value)
+}
+
+type ArrayLiteral struct {
+	Token    token.Token // [ token
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) TokenLiteral() string  { return al.Token.Value }
+func (al *ArrayLiteral) GetToken() token.Token { return al.Token }
+func (al *ArrayLiteral) ExpressionNode()       {}
+func (al *ArrayLiteral) String() string {
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// HashLiteral keeps its pairs in source order, Keys[i] being associated to Values[i]
+type HashLiteral struct {
+	Token  token.Token // { token
+	Keys   []Expression
+	Values []Expression
+}
+
+func (hl *HashLiteral) TokenLiteral() string  { return hl.Token.Value }
+func (hl *HashLiteral) GetToken() token.Token { return hl.Token }
+func (hl *HashLiteral) ExpressionNode()       {}
+func (hl *HashLiteral) String() string {
+	pairs := []string{}
+	for i, key := range hl.Keys {
+		pairs = append(pairs, key.String()+": "+hl.Values[i].String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+type IndexExpression struct {
+	Token token.Token // [ token
+	Left  Expression
+	Index Expression
+}
+
+func (ie *IndexExpression) TokenLiteral() string  { return ie.Token.Value }
+func (ie *IndexExpression) GetToken() token.Token { return ie.Token }
+func (ie *IndexExpression) ExpressionNode()       {}
+func (ie *IndexExpression) String() string {
+	return "(" + ie.Left.String() + "[" + ie.Index.String() + "])"
+}
+
+// SliceExpression is xs[Start:End], Start and End are nil when omitted
+type SliceExpression struct {
+	Token token.Token // [ token
+	Left  Expression
+	Start Expression
+	End   Expression
+}
+
+func (se *SliceExpression) TokenLiteral() string  { return se.Token.Value }
+func (se *SliceExpression) GetToken() token.Token { return se.Token }
+func (se *SliceExpression) ExpressionNode()       {}
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(" + se.Left.String() + "[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+	out.WriteString("])")
+	return out.String()
+}
+
 type BlockStatement struct {
 	Token      token.Token // { token
 	Statements []Statement
 }
 
-func (sb *BlockStatement) TokenLiteral() string { return sb.Token.Value }
+func (sb *BlockStatement) TokenLiteral() string  { return sb.Token.Value }
+func (sb *BlockStatement) GetToken() token.Token { return sb.Token }
 func (sb *BlockStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("")
@@ -198,8 +469,9 @@ type IfExpression struct {
 	ElseConsequences *BlockStatement
 }
 
-func (is *IfExpression) TokenLiteral() string { return is.Token.Value }
-func (is *IfExpression) ExpressionNode()      {}
+func (is *IfExpression) TokenLiteral() string  { return is.Token.Value }
+func (is *IfExpression) GetToken() token.Token { return is.Token }
+func (is *IfExpression) ExpressionNode()       {}
 func (is *IfExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("if")
@@ -214,14 +486,15 @@ func (is *IfExpression) String() string {
 	return out.String()
 }
 
-type AssignementStatement struct{
-  Token token.Token
-  Name *Identifier
-  Value Expression
+type AssignementStatement struct {
+	Token token.Token
+	Name  *Identifier
+	Value Expression
 }
 
-func (as *AssignementStatement) TokenLiteral() string { return as.Token.Value }
-func (as *AssignementStatement) StatementNode()       {}
+func (as *AssignementStatement) TokenLiteral() string  { return as.Token.Value }
+func (as *AssignementStatement) GetToken() token.Token { return as.Token }
+func (as *AssignementStatement) StatementNode()        {}
 func (as *AssignementStatement) String() string {
 	var out bytes.Buffer
 
@@ -236,8 +509,9 @@ type LetStatement struct {
 	Value Expression
 }
 
-func (ls *LetStatement) TokenLiteral() string { return ls.Token.Value }
-func (ls *LetStatement) StatementNode()       {}
+func (ls *LetStatement) TokenLiteral() string  { return ls.Token.Value }
+func (ls *LetStatement) GetToken() token.Token { return ls.Token }
+func (ls *LetStatement) StatementNode()        {}
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
@@ -245,3 +519,31 @@ func (ls *LetStatement) String() string {
 
 	return out.String()
 }
+
+// ImportStatement binds Name to the module of the file at Path
+type ImportStatement struct {
+	Token token.Token
+	Path  string
+	Name  *Identifier
+}
+
+func (is *ImportStatement) TokenLiteral() string  { return is.Token.Value }
+func (is *ImportStatement) GetToken() token.Token { return is.Token }
+func (is *ImportStatement) StatementNode()        {}
+func (is *ImportStatement) String() string {
+	return "import " + strconv.Quote(is.Path) + " as " + is.Name.String() + ";"
+}
+
+// MemberExpression is module.member
+type MemberExpression struct {
+	Token  token.Token // . token
+	Left   Expression
+	Member *Identifier
+}
+
+func (me *MemberExpression) TokenLiteral() string  { return me.Token.Value }
+func (me *MemberExpression) GetToken() token.Token { return me.Token }
+func (me *MemberExpression) ExpressionNode()       {}
+func (me *MemberExpression) String() string {
+	return "(" + me.Left.String() + "." + me.Member.String() + ")"
+}
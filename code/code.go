@@ -0,0 +1,282 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/tysufa/qfa/token"
+)
+
+// Instructions is the bytecode of a function: each opcode is followed by its
+// operands, stored in big endian
+type Instructions []byte
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // push a constant of the pool
+	OpPop
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpPow
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpGreaterEqual
+	OpLessThan
+	OpLessEqual
+	OpIn // membership of the value below the top of the stack in the collection on top
+
+	OpMinus
+	OpBitNot
+	OpNot  // negate the boolean on top of the stack
+	OpTest // replace the top of the stack by its truthiness, the operand tells what it is for the error messages
+
+	OpJump
+	OpJumpNotTruthy // pop a boolean and jump if it's false
+
+	OpGetGlobal
+	OpDefineGlobal
+	OpSetGlobal // assign a global, which must have been defined
+	OpGetLocal  // operands are the number of scopes to go up and the slot in that scope
+	OpSetLocal
+	OpEnterScope // push a scope with the given number of slots
+	OpLeaveScope
+
+	OpArray
+	OpHash
+	OpIndex
+	OpSlice // the operand tells which bounds are given, see SliceStart and SliceEnd
+	OpRange // create a range from the bounds on the stack, the operand tells its kind, see RangeInclusive and RangeStep
+
+	OpClosure
+	OpCall
+	OpTailCall // call in place of the current function
+	OpReturnValue
+	OpReturn // return null
+
+	OpPrint
+
+	OpThrow
+	OpTry    // set up a handler jumping to the operand when an error is raised
+	OpEndTry // remove the last handler
+	OpCatch  // turn the error on top of the stack into the value bound by catch
+	OpRethrow
+
+	OpImport // push the module of the file whose path is the constant at the operand, running the file the first time
+	OpMember // replace the module on top of the stack by its global named by the constant at the operand
+
+	OpIter     // replace the value on top of the stack by an iterator over its elements
+	OpIterNext // push the next element of the iterator on top of the stack, or its key and value if the second operand is 2, or jump to the first operand once there is none left
+)
+
+// operands of OpTest, telling which operator the value is an operand of
+const (
+	TestAnd = iota
+	TestOr
+)
+
+// bounds given to an OpSlice, they are on the stack after the sliced value
+const (
+	SliceStart = 1 << iota
+	SliceEnd
+)
+
+// flags of an OpRange, with RangeStep the step is on the stack after the bounds
+const (
+	RangeInclusive = 1 << iota
+	RangeStep
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int // in bytes
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+	OpTrue:     {"OpTrue", []int{}},
+	OpFalse:    {"OpFalse", []int{}},
+	OpNull:     {"OpNull", []int{}},
+
+	OpAdd:          {"OpAdd", []int{}},
+	OpSub:          {"OpSub", []int{}},
+	OpMul:          {"OpMul", []int{}},
+	OpDiv:          {"OpDiv", []int{}},
+	OpMod:          {"OpMod", []int{}},
+	OpPow:          {"OpPow", []int{}},
+	OpBitAnd:       {"OpBitAnd", []int{}},
+	OpBitOr:        {"OpBitOr", []int{}},
+	OpBitXor:       {"OpBitXor", []int{}},
+	OpShiftLeft:    {"OpShiftLeft", []int{}},
+	OpShiftRight:   {"OpShiftRight", []int{}},
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpIn:           {"OpIn", []int{}},
+
+	OpMinus:  {"OpMinus", []int{}},
+	OpBitNot: {"OpBitNot", []int{}},
+	OpNot:    {"OpNot", []int{}},
+	OpTest:   {"OpTest", []int{1}},
+
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+
+	OpGetGlobal:    {"OpGetGlobal", []int{2}},
+	OpDefineGlobal: {"OpDefineGlobal", []int{2}},
+	OpSetGlobal:    {"OpSetGlobal", []int{2}},
+	OpGetLocal:     {"OpGetLocal", []int{1, 2}},
+	OpSetLocal:     {"OpSetLocal", []int{1, 2}},
+	OpEnterScope:   {"OpEnterScope", []int{2}},
+	OpLeaveScope:   {"OpLeaveScope", []int{}},
+
+	OpArray: {"OpArray", []int{2}},
+	OpHash:  {"OpHash", []int{2}},
+	OpIndex: {"OpIndex", []int{}},
+	OpSlice: {"OpSlice", []int{1}},
+	OpRange: {"OpRange", []int{1}},
+
+	OpClosure:     {"OpClosure", []int{2}},
+	OpCall:        {"OpCall", []int{1}},
+	OpTailCall:    {"OpTailCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+
+	OpPrint: {"OpPrint", []int{1}},
+
+	OpThrow:   {"OpThrow", []int{}},
+	OpTry:     {"OpTry", []int{2}},
+	OpEndTry:  {"OpEndTry", []int{}},
+	OpCatch:   {"OpCatch", []int{}},
+	OpRethrow: {"OpRethrow", []int{}},
+
+	OpImport: {"OpImport", []int{2}},
+	OpMember: {"OpMember", []int{2}},
+
+	OpIter:     {"OpIter", []int{}},
+	OpIterNext: {"OpIterNext", []int{2, 1}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make encodes an instruction, an unknown opcode gives an empty instruction
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	length := 1
+	for _, width := range def.OperandWidths {
+		length += width
+	}
+
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, operand := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(operand))
+		case 1:
+			instruction[offset] = byte(operand)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands following an opcode, it also returns the
+// number of bytes they take
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 { return binary.BigEndian.Uint16(ins) }
+func ReadUint8(ins Instructions) uint8   { return uint8(ins[0]) }
+
+// String disassembles the instructions, one per line preceded by its offset
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	if len(operands) != len(def.OperandWidths) {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), len(def.OperandWidths))
+	}
+
+	switch len(operands) {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operand count for %s\n", def.Name)
+}
+
+// Position maps the instruction starting at Offset to the token it was compiled
+// from, so that errors can tell where they happened
+type Position struct {
+	Offset int
+	Token  token.Token
+}
@@ -0,0 +1,863 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tysufa/qfa/ast"
+	"github.com/tysufa/qfa/code"
+	"github.com/tysufa/qfa/object"
+	"github.com/tysufa/qfa/resolver"
+	"github.com/tysufa/qfa/token"
+)
+
+var infixOperators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"**": code.OpPow,
+	"&":  code.OpBitAnd,
+	"|":  code.OpBitOr,
+	"^":  code.OpBitXor,
+	"<<": code.OpShiftLeft,
+	">>": code.OpShiftRight,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	">":  code.OpGreaterThan,
+	">=": code.OpGreaterEqual,
+	"<":  code.OpLessThan,
+	"<=": code.OpLessEqual,
+	"in": code.OpIn,
+}
+
+var prefixOperators = map[string]code.Opcode{
+	"!": code.OpNot,
+	"-": code.OpMinus,
+	"~": code.OpBitNot,
+}
+
+// Bytecode is a compiled program, ready to be run by the vm
+type Bytecode struct {
+	Instructions code.Instructions
+	Positions    []code.Position
+	Constants    []object.Object
+	GlobalNames  []string // names of the globals by index, for the error messages
+}
+
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+	scopes      []*CompilationScope
+
+	tok      token.Token         // token of the node being compiled, recorded for the instructions it emits
+	tailCall *ast.CallExpression // call of the return statement being compiled, if it can be a tail call
+	tooLarge error               // first operand found too large for its instruction, reported once the program is compiled
+}
+
+// CompilationScope holds the code of the function being compiled, the main
+// program being the outermost one
+type CompilationScope struct {
+	instructions code.Instructions
+	positions    []code.Position
+
+	blocks   []int      // offsets of the OpEnterScope of the blocks the code is in, innermost last
+	controls []*control // loops and try statements the code is in, innermost last
+	tryDepth int        // try statements the code is in, finally blocks included
+}
+
+// control is a loop or a try statement, which break, continue and return have
+// to know about to leave it
+type control struct {
+	loop  bool
+	level int          // number of blocks entered around the loop or the try statement
+	table *SymbolTable // symbols visible from the loop or the try statement
+
+	// loops
+	start     int   // offset of the condition
+	breaks    []int // offsets of the jumps to patch with the end of the loop
+	continues []int // offsets of the jumps to patch with the start of the next iteration
+
+	// try statements
+	handlers int                 // handlers set up by OpTry that are still active
+	finally  *ast.BlockStatement // nil if there is none
+}
+
+func New() *Compiler {
+	return NewWithState(NewSymbolTable(), []object.Object{})
+}
+
+// NewWithState creates a compiler that keeps the globals and the constants of
+// the programs compiled before, as needed by the repl
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	return &Compiler{
+		constants:   constants,
+		symbolTable: s,
+		scopes:      []*CompilationScope{{}},
+	}
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.scope().instructions,
+		Positions:    c.scope().positions,
+		Constants:    c.constants,
+		GlobalNames:  c.symbolTable.GlobalNames(),
+	}
+}
+
+// Compile compiles node into the current function. A program is compiled as
+// the body of a function returning the value of its last statement, or nothing
+// when it isn't an expression
+func (c *Compiler) Compile(node ast.Node) error {
+	if positioned, ok := node.(interface{ GetToken() token.Token }); ok {
+		defer func(tok token.Token) { c.tok = tok }(c.tok)
+		c.tok = positioned.GetToken()
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		if err := resolver.Resolve(node.Statements, resolver.NewGlobals(c.isGlobal)); err != nil {
+			return fmt.Errorf("%s at line %d", err.Message, err.Line)
+		}
+		if err := c.compileBody(node.Statements); err != nil {
+			return err
+		}
+		return c.tooLarge
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	case *ast.LetStatement:
+		// a function can refer to itself through the variable it is bound to
+		_, isFunction := node.Value.(*ast.FunctionLiteral)
+		var symbol Symbol
+		if isFunction {
+			symbol = c.symbolTable.Define(node.Name.Value)
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if !isFunction {
+			symbol = c.symbolTable.Define(node.Name.Value)
+		}
+		c.define(symbol)
+	case *ast.ImportStatement:
+		c.emit(code.OpImport, c.addConstant(&object.String{Value: node.Path}))
+		c.define(c.symbolTable.Define(node.Name.Value))
+	case *ast.AssignementStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		symbol := c.symbolTable.Resolve(node.Name.Value)
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Depth, symbol.Index)
+		}
+	case *ast.Identifier:
+		symbol := c.symbolTable.Resolve(node.Value)
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpGetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpGetLocal, symbol.Depth, symbol.Index)
+		}
+	case *ast.IntegerLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: node.Value, Big: node.Big}))
+	case *ast.FloatLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Float{Value: node.Value}))
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		op, ok := prefixOperators[node.Operator]
+		if !ok {
+			return c.errorf("unknown operator: %s", node.Operator)
+		}
+		c.emit(op)
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		op, ok := infixOperators[node.Operator]
+		if !ok {
+			return c.errorf("unknown operator: %s", node.Operator)
+		}
+		c.emit(op)
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+	case *ast.BlockStatement:
+		return c.compileBlock(node, false)
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(node)
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+	case *ast.ForInStatement:
+		return c.compileForInStatement(node)
+	case *ast.BreakStatement:
+		return c.compileLoopJump(true)
+	case *ast.ContinueStatement:
+		return c.compileLoopJump(false)
+	case *ast.ReturnStatement:
+		// the frame of the function can be dropped before calling the returned
+		// call, unless a try block needs to see what the call raises
+		if call, ok := node.Value.(*ast.CallExpression); ok && len(c.scopes) > 1 && c.scope().tryDepth == 0 {
+			c.tailCall = call
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if _, err := c.exit(0); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	case *ast.PrintStatement:
+		if len(node.Arguments) > 255 {
+			return c.errorf("too many arguments to print: %d", len(node.Arguments))
+		}
+		for _, arg := range node.Arguments {
+			if err := c.Compile(arg); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpPrint, len(node.Arguments))
+	case *ast.ThrowStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+	case *ast.TryStatement:
+		return c.compileTryStatement(node)
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node)
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.HashLiteral:
+		for i, key := range node.Keys {
+			if err := c.Compile(key); err != nil {
+				return err
+			}
+			if err := c.Compile(node.Values[i]); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Keys))
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+	case *ast.SliceExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		bounds := 0
+		if node.Start != nil {
+			if err := c.Compile(node.Start); err != nil {
+				return err
+			}
+			bounds |= code.SliceStart
+		}
+		if node.End != nil {
+			if err := c.Compile(node.End); err != nil {
+				return err
+			}
+			bounds |= code.SliceEnd
+		}
+		c.emit(code.OpSlice, bounds)
+	case *ast.RangeExpression:
+		if err := c.Compile(node.Start); err != nil {
+			return err
+		}
+		if err := c.Compile(node.End); err != nil {
+			return err
+		}
+		flags := 0
+		if node.Inclusive {
+			flags |= code.RangeInclusive
+		}
+		if node.Step != nil {
+			if err := c.Compile(node.Step); err != nil {
+				return err
+			}
+			flags |= code.RangeStep
+		}
+		c.emit(code.OpRange, flags)
+	case *ast.MemberExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		c.emit(code.OpMember, c.addConstant(&object.String{Value: node.Member.Value}))
+	case *ast.CallExpression:
+		tail := c.tailCall == node
+		c.tailCall = nil
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+		if len(node.Arguments) > 255 {
+			return c.errorf("too many arguments: %d", len(node.Arguments))
+		}
+		for _, arg := range node.Arguments {
+			if err := c.Compile(arg); err != nil {
+				return err
+			}
+		}
+		if tail {
+			c.emit(code.OpTailCall, len(node.Arguments))
+		} else {
+			c.emit(code.OpCall, len(node.Arguments))
+		}
+	default:
+		return c.errorf("cannot compile %T", node)
+	}
+
+	return nil
+}
+
+// compileBody compiles the statements of a function, which returns the value
+// of the last one if it is an expression
+func (c *Compiler) compileBody(statements []ast.Statement) error {
+	value, err := c.compileStatements(statements, true)
+	if err != nil {
+		return err
+	}
+	if value {
+		c.emit(code.OpReturnValue)
+	} else {
+		c.emit(code.OpReturn)
+	}
+	return nil
+}
+
+// compileStatements compiles statements, leaving the value of the last one on
+// the stack when value is set and it is an expression. It reports whether it did
+func (c *Compiler) compileStatements(statements []ast.Statement, value bool) (bool, error) {
+	for i, stmt := range statements {
+		if expr, ok := stmt.(*ast.ExpressionStatement); ok && value && i == len(statements)-1 {
+			return true, c.Compile(expr.Expression)
+		}
+		if err := c.Compile(stmt); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// compileBlock compiles block in a scope of its own, needed only if it
+// declares variables. With value set, the block leaves its value on the stack:
+// the one of its last statement, or null
+func (c *Compiler) compileBlock(block *ast.BlockStatement, value bool) error {
+	if block == nil {
+		if value {
+			c.emit(code.OpNull)
+		}
+		return nil
+	}
+
+	scoped := declares(block.Statements)
+	if scoped {
+		c.enterBlock()
+		c.declareLets(block.Statements)
+	}
+	left, err := c.compileStatements(block.Statements, value)
+	if err != nil {
+		return err
+	}
+	if value && !left {
+		c.emit(code.OpNull)
+	}
+	if scoped {
+		c.leaveBlock()
+	}
+	return nil
+}
+
+// define emits the code storing the value on top of the stack in the variable
+// being declared
+func (c *Compiler) define(symbol Symbol) {
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpDefineGlobal, symbol.Index)
+	} else {
+		c.emit(code.OpSetLocal, 0, symbol.Index)
+	}
+}
+
+// declareLets declares the variables of statements when their scope is entered,
+// so that the functions declared before them can refer to them
+func (c *Compiler) declareLets(statements []ast.Statement) {
+	for _, stmt := range statements {
+		if name := declaredName(stmt); name != "" {
+			c.symbolTable.reserve(name)
+		}
+	}
+}
+
+func declares(statements []ast.Statement) bool {
+	for _, stmt := range statements {
+		if declaredName(stmt) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// declaredName gives the name of the variable stmt declares, if any
+func declaredName(stmt ast.Statement) string {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Name.Value
+	case *ast.ImportStatement:
+		return stmt.Name.Value
+	}
+	return ""
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	jumpNotTruthy := c.emit(code.OpJumpNotTruthy, 0)
+
+	if err := c.compileBlock(node.Consequences, true); err != nil {
+		return err
+	}
+	jump := c.emit(code.OpJump, 0)
+
+	c.changeOperand(jumpNotTruthy, len(c.scope().instructions))
+	if err := c.compileBlock(node.ElseConsequences, true); err != nil {
+		return err
+	}
+	c.changeOperand(jump, len(c.scope().instructions))
+	return nil
+}
+
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	loop := &control{loop: true, level: len(c.scope().blocks), table: c.symbolTable, start: len(c.scope().instructions)}
+
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	jumpNotTruthy := c.emit(code.OpJumpNotTruthy, 0)
+
+	c.scope().controls = append(c.scope().controls, loop)
+	err := c.compileBlock(node.Instructions, false)
+	c.scope().controls = c.scope().controls[:len(c.scope().controls)-1]
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpJump, loop.start)
+
+	c.changeOperand(jumpNotTruthy, len(c.scope().instructions))
+	c.patchLoop(loop, loop.start)
+	return nil
+}
+
+// compileForStatement compiles the initialization in a block enclosing the
+// loop, if it declares a variable, and the update where continue jumps to
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	scoped := declaredName(node.Init) != ""
+	if scoped {
+		c.enterBlock()
+		c.declareLets([]ast.Statement{node.Init})
+	}
+	if node.Init != nil {
+		if err := c.Compile(node.Init); err != nil {
+			return err
+		}
+	}
+
+	loop := &control{loop: true, level: len(c.scope().blocks), table: c.symbolTable, start: len(c.scope().instructions)}
+	jumpNotTruthy := -1
+	if node.Condition != nil {
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+		jumpNotTruthy = c.emit(code.OpJumpNotTruthy, 0)
+	}
+
+	c.scope().controls = append(c.scope().controls, loop)
+	err := c.compileBlock(node.Body, false)
+	c.scope().controls = c.scope().controls[:len(c.scope().controls)-1]
+	if err != nil {
+		return err
+	}
+
+	update := len(c.scope().instructions)
+	if node.Update != nil {
+		if err := c.Compile(node.Update); err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpJump, loop.start)
+
+	if jumpNotTruthy >= 0 {
+		c.changeOperand(jumpNotTruthy, len(c.scope().instructions))
+	}
+	c.patchLoop(loop, update)
+	if scoped {
+		c.leaveBlock()
+	}
+	return nil
+}
+
+// compileForInStatement keeps the iterator on the stack during the loop, each
+// iteration storing the elements it gives in the variables of a new block
+func (c *Compiler) compileForInStatement(node *ast.ForInStatement) error {
+	if err := c.Compile(node.Iterable); err != nil {
+		return err
+	}
+	c.emit(code.OpIter)
+
+	loop := &control{loop: true, level: len(c.scope().blocks), table: c.symbolTable, start: len(c.scope().instructions)}
+	next := c.emit(code.OpIterNext, 0, len(node.Variables))
+
+	c.enterBlock()
+	symbols := []Symbol{}
+	for _, variable := range node.Variables {
+		symbols = append(symbols, c.symbolTable.Define(variable.Value))
+	}
+	c.declareLets(node.Body.Statements)
+	// the value is on top of the key
+	for i := len(symbols) - 1; i >= 0; i-- {
+		c.emit(code.OpSetLocal, 0, symbols[i].Index)
+	}
+
+	c.scope().controls = append(c.scope().controls, loop)
+	_, err := c.compileStatements(node.Body.Statements, false)
+	c.scope().controls = c.scope().controls[:len(c.scope().controls)-1]
+	if err != nil {
+		return err
+	}
+	c.leaveBlock()
+	c.emit(code.OpJump, loop.start)
+
+	c.changeOperand(next, len(c.scope().instructions))
+	c.patchLoop(loop, loop.start)
+	// the end of the loop, where break jumps to, drops the iterator
+	c.emit(code.OpPop)
+	return nil
+}
+
+// patchLoop makes the breaks of loop jump to its end, which is where the code
+// is, and its continues jump to next
+func (c *Compiler) patchLoop(loop *control, next int) {
+	end := len(c.scope().instructions)
+	for _, pos := range loop.breaks {
+		c.changeOperand(pos, end)
+	}
+	for _, pos := range loop.continues {
+		c.changeOperand(pos, next)
+	}
+}
+
+// compileLoopJump compiles a break, or a continue if isBreak is false
+func (c *Compiler) compileLoopJump(isBreak bool) error {
+	controls := c.scope().controls
+	i := len(controls) - 1
+	for i >= 0 && !controls[i].loop {
+		i--
+	}
+	if i < 0 {
+		if isBreak {
+			return c.errorf("break outside of a loop")
+		}
+		return c.errorf("continue outside of a loop")
+	}
+	loop := controls[i]
+
+	level, err := c.exit(i + 1)
+	if err != nil {
+		return err
+	}
+	c.leaveBlocks(level - loop.level)
+
+	if isBreak {
+		loop.breaks = append(loop.breaks, c.emit(code.OpJump, 0))
+	} else {
+		loop.continues = append(loop.continues, c.emit(code.OpJump, 0))
+	}
+	return nil
+}
+
+// exit emits the code leaving the try statements among controls[outer:],
+// innermost first: their handlers are removed and their finally blocks run.
+// It returns the number of blocks the code is in once they are left
+func (c *Compiler) exit(outer int) (int, error) {
+	scope := c.scope()
+	level := len(scope.blocks)
+
+	for i := len(scope.controls) - 1; i >= outer; i-- {
+		try := scope.controls[i]
+		if try.loop {
+			continue
+		}
+
+		c.leaveBlocks(level - try.level)
+		level = try.level
+		for j := 0; j < try.handlers; j++ {
+			c.emit(code.OpEndTry)
+		}
+		if try.finally == nil {
+			continue
+		}
+
+		// the finally block is compiled where the try statement is, the code
+		// following the exit is compiled where it was
+		controls, blocks, table := scope.controls, scope.blocks, c.symbolTable
+		scope.controls = append([]*control{}, controls[:i]...)
+		scope.blocks = append([]int{}, blocks[:level]...)
+		c.symbolTable = try.table
+		err := c.compileBlock(try.finally, false)
+		scope.controls, scope.blocks, c.symbolTable = controls, blocks, table
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return level, nil
+}
+
+// compileTryStatement sets up a handler for the catch block and one for the
+// finally block, which runs the finally block before raising the error again.
+// Without error, the finally block runs after the body or the catch block
+func (c *Compiler) compileTryStatement(node *ast.TryStatement) error {
+	scope := c.scope()
+	scope.tryDepth++
+	defer func() { scope.tryDepth-- }()
+
+	try := &control{level: len(scope.blocks), table: c.symbolTable, finally: node.Finally}
+	var finallyHandler, catchHandler int
+	if node.Finally != nil {
+		finallyHandler = c.emit(code.OpTry, 0)
+		try.handlers++
+	}
+	if node.Catch != nil {
+		catchHandler = c.emit(code.OpTry, 0)
+		try.handlers++
+	}
+
+	scope.controls = append(scope.controls, try)
+	if err := c.compileBlock(node.Body, false); err != nil {
+		return err
+	}
+
+	if node.Catch != nil {
+		c.emit(code.OpEndTry)
+		jump := c.emit(code.OpJump, 0)
+
+		c.changeOperand(catchHandler, len(scope.instructions))
+		try.handlers--
+		c.emit(code.OpCatch)
+		c.enterBlock()
+		param := c.symbolTable.Define(node.CatchParam.Value)
+		c.declareLets(node.Catch.Statements)
+		c.emit(code.OpSetLocal, 0, param.Index)
+		if _, err := c.compileStatements(node.Catch.Statements, false); err != nil {
+			return err
+		}
+		c.leaveBlock()
+
+		c.changeOperand(jump, len(scope.instructions))
+	}
+	scope.controls = scope.controls[:len(scope.controls)-1]
+
+	if node.Finally != nil {
+		c.emit(code.OpEndTry)
+		if err := c.compileBlock(node.Finally, false); err != nil {
+			return err
+		}
+		jump := c.emit(code.OpJump, 0)
+
+		c.changeOperand(finallyHandler, len(scope.instructions))
+		c.enterBlock()
+		slot := c.symbolTable.defineAnonymous()
+		c.emit(code.OpSetLocal, 0, slot.Index)
+		if _, err := c.compileStatements(node.Finally.Statements, false); err != nil {
+			return err
+		}
+		c.emit(code.OpGetLocal, 0, slot.Index)
+		c.leaveBlock()
+		c.emit(code.OpRethrow)
+
+		c.changeOperand(jump, len(scope.instructions))
+	}
+
+	return nil
+}
+
+// compileLogicalExpression short-circuits like the evaluator, the result being
+// the truthiness of the operand that decided it
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	test := code.TestAnd
+	if node.Operator == "||" {
+		test = code.TestOr
+	}
+
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+	c.emit(code.OpTest, test)
+	jumpNotTruthy := c.emit(code.OpJumpNotTruthy, 0)
+
+	if node.Operator == "&&" {
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(code.OpTest, test)
+		jump := c.emit(code.OpJump, 0)
+		c.changeOperand(jumpNotTruthy, len(c.scope().instructions))
+		c.emit(code.OpFalse)
+		c.changeOperand(jump, len(c.scope().instructions))
+		return nil
+	}
+
+	c.emit(code.OpTrue)
+	jump := c.emit(code.OpJump, 0)
+	c.changeOperand(jumpNotTruthy, len(c.scope().instructions))
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+	c.emit(code.OpTest, test)
+	c.changeOperand(jump, len(c.scope().instructions))
+	return nil
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	c.scopes = append(c.scopes, &CompilationScope{})
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+	c.symbolTable.function = true
+
+	for _, param := range node.Parameters {
+		c.symbolTable.defineParameter(param.Value)
+	}
+	c.declareLets(node.Body.Statements)
+	err := c.compileBody(node.Body.Statements)
+
+	scope := c.scope()
+	numLocals := c.symbolTable.numDefinitions
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.symbolTable = c.symbolTable.Outer
+	if err != nil {
+		return err
+	}
+
+	params := []string{}
+	for _, param := range node.Parameters {
+		params = append(params, param.String())
+	}
+
+	fn := &object.CompiledFunction{
+		Instructions:  scope.instructions,
+		Positions:     scope.positions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Name:          node.Name,
+		Literal:       "fn(" + strings.Join(params, ", ") + "){" + node.Body.String() + "}",
+	}
+	c.emit(code.OpClosure, c.addConstant(fn))
+	return nil
+}
+
+func (c *Compiler) enterBlock() {
+	scope := c.scope()
+	scope.blocks = append(scope.blocks, c.emit(code.OpEnterScope, 0))
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+// leaveBlock ends the innermost block, whose size is only known now
+func (c *Compiler) leaveBlock() {
+	scope := c.scope()
+	c.changeOperand(scope.blocks[len(scope.blocks)-1], c.symbolTable.numDefinitions)
+	scope.blocks = scope.blocks[:len(scope.blocks)-1]
+	c.emit(code.OpLeaveScope)
+	c.symbolTable = c.symbolTable.Outer
+}
+
+// leaveBlocks emits the code leaving n blocks when jumping out of them
+func (c *Compiler) leaveBlocks(n int) {
+	for i := 0; i < n; i++ {
+		c.emit(code.OpLeaveScope)
+	}
+}
+
+func (c *Compiler) scope() *CompilationScope {
+	return c.scopes[len(c.scopes)-1]
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// emit appends an instruction to the current function and returns its offset
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	scope := c.scope()
+	pos := len(scope.instructions)
+	c.checkOperands(op, operands)
+	scope.instructions = append(scope.instructions, code.Make(op, operands...)...)
+	scope.positions = append(scope.positions, code.Position{Offset: pos, Token: c.tok})
+	return pos
+}
+
+// changeOperand replaces the first operand of the instruction at pos, once the
+// target of a jump or the size of a scope is known
+func (c *Compiler) changeOperand(pos int, operand int) {
+	scope := c.scope()
+	op := code.Opcode(scope.instructions[pos])
+	def, _ := code.Lookup(byte(op))
+	operands, _ := code.ReadOperands(def, scope.instructions[pos+1:])
+	operands[0] = operand
+	c.checkOperands(op, operands)
+	copy(scope.instructions[pos:], code.Make(op, operands...))
+}
+
+// checkOperands records an error if one of operands doesn't fit in the bytes
+// op gives it, code.Make would silently truncate it
+func (c *Compiler) checkOperands(op code.Opcode, operands []int) {
+	def, _ := code.Lookup(byte(op))
+	for i, width := range def.OperandWidths {
+		max := 1<<(8*width) - 1
+		if operands[i] > max && c.tooLarge == nil {
+			c.tooLarge = c.errorf("program too large: operand %d of %s exceeds %d", operands[i], def.Name, max)
+		}
+	}
+}
+
+// isGlobal tells whether name was given a global index by the programs compiled
+// before, as in the repl
+func (c *Compiler) isGlobal(name string) bool {
+	table := c.symbolTable
+	for table.Outer != nil {
+		table = table.Outer
+	}
+	_, ok := table.store[name]
+	return ok
+}
+
+func (c *Compiler) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf(format+" at line %d", append(a, c.tok.Line)...)
+}
@@ -0,0 +1,415 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tysufa/qfa/ast"
+	"github.com/tysufa/qfa/code"
+	"github.com/tysufa/qfa/lexer"
+	"github.com/tysufa/qfa/object"
+	"github.com/tysufa/qfa/parser"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "1; 2 ** 3;",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpPow),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "-~1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpBitNot),
+				code.Make(code.OpMinus),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if (true) { 10 }; 20;",
+			expectedConstants: []interface{}{10, 20},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),              // 0000
+				code.Make(code.OpJumpNotTruthy, 10), // 0001
+				code.Make(code.OpConstant, 0),       // 0004
+				code.Make(code.OpJump, 11),          // 0007
+				code.Make(code.OpNull),              // 0010
+				code.Make(code.OpPop),               // 0011
+				code.Make(code.OpConstant, 1),       // 0012
+				code.Make(code.OpReturnValue),       // 0015
+			},
+		},
+		{
+			input:             "true && false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),               // 0000
+				code.Make(code.OpTest, code.TestAnd), // 0001
+				code.Make(code.OpJumpNotTruthy, 12),  // 0003
+				code.Make(code.OpFalse),              // 0006
+				code.Make(code.OpTest, code.TestAnd), // 0007
+				code.Make(code.OpJump, 13),           // 0009
+				code.Make(code.OpFalse),              // 0012
+				code.Make(code.OpReturnValue),        // 0013
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestGlobalsAndScopes(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let one = 1; one = 2; one;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpDefineGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			// only the blocks declaring variables get a scope
+			input:             "while (true) { let a = 1; let b = a; } while (false) { }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),              // 0000
+				code.Make(code.OpJumpNotTruthy, 26), // 0001
+				code.Make(code.OpEnterScope, 2),     // 0004
+				code.Make(code.OpConstant, 0),       // 0007
+				code.Make(code.OpSetLocal, 0, 0),    // 0010
+				code.Make(code.OpGetLocal, 0, 0),    // 0014
+				code.Make(code.OpSetLocal, 0, 1),    // 0018
+				code.Make(code.OpLeaveScope),        // 0022
+				code.Make(code.OpJump, 0),           // 0023
+				code.Make(code.OpFalse),             // 0026
+				code.Make(code.OpJumpNotTruthy, 33), // 0027
+				code.Make(code.OpJump, 26),          // 0030
+				code.Make(code.OpReturn),            // 0033
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestForLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// continue jumps to the update
+			input:             "for (let i = 0; i < 2; i = i + 1) { continue; }",
+			expectedConstants: []interface{}{0, 2, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpEnterScope, 1),     // 0000
+				code.Make(code.OpConstant, 0),       // 0003
+				code.Make(code.OpSetLocal, 0, 0),    // 0006
+				code.Make(code.OpGetLocal, 0, 0),    // 0010
+				code.Make(code.OpConstant, 1),       // 0014
+				code.Make(code.OpLessThan),          // 0017
+				code.Make(code.OpJumpNotTruthy, 39), // 0018
+				code.Make(code.OpJump, 24),          // 0021
+				code.Make(code.OpGetLocal, 0, 0),    // 0024
+				code.Make(code.OpConstant, 2),       // 0028
+				code.Make(code.OpAdd),               // 0031
+				code.Make(code.OpSetLocal, 0, 0),    // 0032
+				code.Make(code.OpJump, 10),          // 0036
+				code.Make(code.OpLeaveScope),        // 0039
+				code.Make(code.OpReturn),            // 0040
+			},
+		},
+		{
+			// the iterator stays on the stack until the end of the loop
+			input:             "for (k, v in {}) { break; }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),         // 0000
+				code.Make(code.OpIter),            // 0003
+				code.Make(code.OpIterNext, 27, 2), // 0004
+				code.Make(code.OpEnterScope, 2),   // 0008
+				code.Make(code.OpSetLocal, 0, 1),  // 0011
+				code.Make(code.OpSetLocal, 0, 0),  // 0015
+				code.Make(code.OpLeaveScope),      // 0019
+				code.Make(code.OpJump, 27),        // 0020
+				code.Make(code.OpLeaveScope),      // 0023
+				code.Make(code.OpJump, 4),         // 0024
+				code.Make(code.OpPop),             // 0027
+				code.Make(code.OpReturn),          // 0028
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestRanges(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "3 in 1..=5 step 2",
+			expectedConstants: []interface{}{3, 1, 5, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),                               // 0000
+				code.Make(code.OpConstant, 1),                               // 0003
+				code.Make(code.OpConstant, 2),                               // 0006
+				code.Make(code.OpConstant, 3),                               // 0009
+				code.Make(code.OpRange, code.RangeInclusive|code.RangeStep), // 0012
+				code.Make(code.OpIn),                                        // 0014
+				code.Make(code.OpReturnValue),                               // 0015
+			},
+		},
+		{
+			input:             "0..1",
+			expectedConstants: []interface{}{0, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0), // 0000
+				code.Make(code.OpConstant, 1), // 0003
+				code.Make(code.OpRange, 0),    // 0006
+				code.Make(code.OpReturnValue), // 0008
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestImports(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `import "lib.qfa" as lib; if (true) { import "lib.qfa" as l; l.x }`,
+			expectedConstants: []interface{}{"lib.qfa", "lib.qfa", "x"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpImport, 0),         // 0000
+				code.Make(code.OpDefineGlobal, 0),   // 0003
+				code.Make(code.OpTrue),              // 0006
+				code.Make(code.OpJumpNotTruthy, 31), // 0007
+				code.Make(code.OpEnterScope, 1),     // 0010
+				code.Make(code.OpImport, 1),         // 0013
+				code.Make(code.OpSetLocal, 0, 0),    // 0016
+				code.Make(code.OpGetLocal, 0, 0),    // 0020
+				code.Make(code.OpMember, 2),         // 0024
+				code.Make(code.OpLeaveScope),        // 0027
+				code.Make(code.OpJump, 32),          // 0028
+				code.Make(code.OpNull),              // 0031
+				code.Make(code.OpReturnValue),       // 0032
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFunctions(t *testing.T) {
+	bytecode := compile(t, "let f = fn(a) { let b = a; return f(b); }; f(1);")
+
+	expected := concatInstructions([]code.Instructions{
+		code.Make(code.OpClosure, 0),
+		code.Make(code.OpDefineGlobal, 0),
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpCall, 1),
+		code.Make(code.OpReturnValue),
+	})
+	if bytecode.Instructions.String() != expected.String() {
+		t.Errorf("wrong instructions.\nwant=%s\ngot=%s", expected, bytecode.Instructions)
+	}
+
+	fn, ok := bytecode.Constants[0].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant is not a CompiledFunction. got=%T", bytecode.Constants[0])
+	}
+	if fn.Name != "f" || fn.NumParameters != 1 || fn.NumLocals != 2 {
+		t.Errorf("wrong function. name=%q, parameters=%d, locals=%d", fn.Name, fn.NumParameters, fn.NumLocals)
+	}
+
+	// the returned call is a tail call
+	expected = concatInstructions([]code.Instructions{
+		code.Make(code.OpGetLocal, 0, 0),
+		code.Make(code.OpSetLocal, 0, 1),
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpGetLocal, 0, 1),
+		code.Make(code.OpTailCall, 1),
+		code.Make(code.OpReturnValue),
+		code.Make(code.OpReturn),
+	})
+	if fn.Instructions.String() != expected.String() {
+		t.Errorf("wrong function instructions.\nwant=%s\ngot=%s", expected, fn.Instructions)
+	}
+}
+
+func TestClosureScopes(t *testing.T) {
+	bytecode := compile(t, "fn(a) { if (a) { let b = a; fn() { a + b } } }")
+
+	outer := bytecode.Constants[len(bytecode.Constants)-1].(*object.CompiledFunction)
+	inner := bytecode.Constants[0].(*object.CompiledFunction)
+
+	if !strings.Contains(outer.Instructions.String(), "OpEnterScope 1") {
+		t.Errorf("the block declaring b has no scope:\n%s", outer.Instructions)
+	}
+	expected := concatInstructions([]code.Instructions{
+		code.Make(code.OpGetLocal, 2, 0),
+		code.Make(code.OpGetLocal, 1, 0),
+		code.Make(code.OpAdd),
+		code.Make(code.OpReturnValue),
+	})
+	if inner.Instructions.String() != expected.String() {
+		t.Errorf("wrong closure instructions.\nwant=%s\ngot=%s", expected, inner.Instructions)
+	}
+}
+
+func TestPositions(t *testing.T) {
+	bytecode := compile(t, "let a = 1;\nlet b = a + true;")
+
+	fn := &object.CompiledFunction{Instructions: bytecode.Instructions, Positions: bytecode.Positions}
+	// OpConstant, OpDefineGlobal, OpGetGlobal, OpTrue, OpAdd
+	tok := fn.TokenAt(10)
+	if tok.Value != "+" || tok.Line != 2 || tok.Column != 11 {
+		t.Errorf("wrong token for OpAdd. got=%q at %d:%d", tok.Value, tok.Line, tok.Column)
+	}
+}
+
+func TestCompilerErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "break outside of a loop at line 1"},
+		{"let f = fn() {\n continue;\n};", "continue outside of a loop at line 2"},
+		{"while (true) { fn() { break; }; }", "break outside of a loop at line 1"},
+		{"let s = 0;\n" + strings.Repeat("s = s + 1;\n", 70000), "program too large: operand 65536 of OpConstant exceeds 65535 at line 65537"},
+		{"while (false) {\n" + strings.Repeat("true;\n", 40000) + "}", "program too large: operand 80007 of OpJumpNotTruthy exceeds 65535 at line 1"},
+		{"if (true) { let a = 1; " + strings.Repeat("if (true) { let b = 1; ", 300) + "a;" + strings.Repeat("}", 301), "program too large: operand 300 of OpGetLocal exceeds 255 at line 1"},
+	}
+
+	for _, tt := range tests {
+		err := New().Compile(parse(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestSymbolTable(t *testing.T) {
+	global := NewSymbolTable()
+	used := global.Resolve("later")
+	a := global.Define("a")
+	if defined := global.Define("later"); defined != used {
+		t.Errorf("global used before being declared got a new index. used=%+v, defined=%+v", used, defined)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	b := local.Define("b")
+	nested := NewEnclosedSymbolTable(local)
+	nested.Define("a")
+
+	tests := []struct {
+		table    *SymbolTable
+		name     string
+		expected Symbol
+	}{
+		{global, "a", a},
+		{local, "a", a},
+		{local, "b", b},
+		{nested, "b", Symbol{Name: "b", Scope: LocalScope, Index: 0, Depth: 1}},
+		{nested, "a", Symbol{Name: "a", Scope: LocalScope, Index: 0, Depth: 0}},
+	}
+
+	for _, tt := range tests {
+		if symbol := tt.table.Resolve(tt.name); symbol != tt.expected {
+			t.Errorf("wrong symbol for %s. expected=%+v, got=%+v", tt.name, tt.expected, symbol)
+		}
+	}
+
+	if names := nested.GlobalNames(); len(names) != 2 || names[0] != "later" || names[1] != "a" {
+		t.Errorf("wrong global names. got=%v", names)
+	}
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		bytecode := compile(t, tt.input)
+
+		expected := concatInstructions(tt.expectedInstructions)
+		if bytecode.Instructions.String() != expected.String() {
+			t.Errorf("wrong instructions for %q.\nwant=%s\ngot=%s", tt.input, expected, bytecode.Instructions)
+		}
+
+		if len(bytecode.Constants) != len(tt.expectedConstants) {
+			t.Fatalf("wrong number of constants. want=%d, got=%d", len(tt.expectedConstants), len(bytecode.Constants))
+		}
+		for i, constant := range tt.expectedConstants {
+			var ok bool
+			switch constant := constant.(type) {
+			case string:
+				str, isString := bytecode.Constants[i].(*object.String)
+				ok = isString && str.Value == constant
+			default:
+				integer, isInteger := bytecode.Constants[i].(*object.Integer)
+				ok = isInteger && integer.Value == constant
+			}
+			if !ok {
+				t.Errorf("wrong constant %d. want=%v, got=%v", i, constant, bytecode.Constants[i])
+			}
+		}
+	}
+}
+
+func compile(t *testing.T, input string) *Bytecode {
+	t.Helper()
+
+	c := New()
+	if err := c.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return c.Bytecode()
+}
+
+func parse(input string) *ast.Program {
+	program := parser.New(lexer.New(input)).GetStatements()
+	return &program
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+	return out
+}
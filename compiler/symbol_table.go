@@ -0,0 +1,110 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope SymbolScope = "GLOBAL"
+	LocalScope  SymbolScope = "LOCAL"
+)
+
+// Symbol is where a variable lives at run time: an index in the globals, or a
+// slot of the scope Depth levels above the one the symbol was resolved from
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	Depth int
+}
+
+// SymbolTable holds the variables of a scope. The outermost table holds the
+// globals, every other table matches one scope created by the vm
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	declared       map[string]bool // variables whose declaration was already compiled
+	numDefinitions int
+	names          []string // names of the globals by index, only used by the outermost table
+	function       bool     // whether the table holds the parameters of a function
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol), declared: make(map[string]bool)}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	table := NewSymbolTable()
+	table.Outer = outer
+	return table
+}
+
+// Define declares name in s. Declaring it again reuses its slot, and a global
+// that was used before being declared keeps the index it was given then
+func (s *SymbolTable) Define(name string) Symbol {
+	s.declared[name] = true
+	return s.reserve(name)
+}
+
+// reserve gives name a slot in s without declaring it yet
+func (s *SymbolTable) reserve(name string) Symbol {
+	if symbol, ok := s.store[name]; ok {
+		return symbol
+	}
+
+	symbol := Symbol{Name: name, Index: s.numDefinitions, Scope: LocalScope}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+		s.names = append(s.names, name)
+	}
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+// defineParameter gives each parameter a slot of its own even when names are
+// repeated, the last parameter of a name being the one visible
+func (s *SymbolTable) defineParameter(name string) Symbol {
+	symbol := Symbol{Name: name, Index: s.numDefinitions, Scope: LocalScope}
+	s.store[name] = symbol
+	s.declared[name] = true
+	s.numDefinitions++
+	return symbol
+}
+
+// defineAnonymous reserves a slot no name can refer to
+func (s *SymbolTable) defineAnonymous() Symbol {
+	symbol := Symbol{Index: s.numDefinitions, Scope: LocalScope}
+	s.numDefinitions++
+	return symbol
+}
+
+// Resolve finds the nearest declaration of name. A name declared nowhere is
+// taken for a global: it can still be declared later, by the time the code
+// using it runs, or be a builtin. A variable not declared yet in the same
+// function is skipped, the use being in the value of its let statement, see
+// resolver.Resolve
+func (s *SymbolTable) Resolve(name string) Symbol {
+	depth := 0
+	table := s
+	sameFunction := true
+	for table.Outer != nil {
+		if symbol, ok := table.store[name]; ok && (table.declared[name] || !sameFunction) {
+			symbol.Depth = depth
+			return symbol
+		}
+		if table.function {
+			sameFunction = false
+		}
+		table = table.Outer
+		depth++
+	}
+	return table.Define(name)
+}
+
+// GlobalNames returns the names of the globals by index
+func (s *SymbolTable) GlobalNames() []string {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s.names
+}
@@ -1,34 +1,118 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
 
 	"github.com/tysufa/qfa/ast"
 	"github.com/tysufa/qfa/object"
+	"github.com/tysufa/qfa/resolver"
+	"github.com/tysufa/qfa/token"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL     = object.NULL
+	TRUE     = object.TRUE
+	FALSE    = object.FALSE
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
+// Truthiness selects how the conditions of if, while, ! and the logical
+// operators treat values that aren't booleans
+type Truthiness = object.Truthiness
+
+const (
+	Lenient = object.Lenient
+	Strict  = object.Strict
+)
+
+// DefaultMaxCallDepth is the number of nested function calls allowed by New
+const DefaultMaxCallDepth = object.DefaultMaxCallDepth
+
+// Evaluator holds the settings of an evaluation, the zero value isn't usable, use New
+type Evaluator struct {
+	Output       io.Writer  // where print writes, os.Stdout by default
+	Truthiness   Truthiness // Lenient by default
+	MaxCallDepth int        // nested calls allowed before a stack overflow error, 0 for no limit
+	Limits       Limits     // no limit by default
+
+	frames   []object.Frame      // functions being called, outermost first
+	tryDepth int                 // try blocks entered since the current function was called
+	tailCall *ast.CallExpression // call of the return statement being evaluated, if it can be a tail call
+
+	modules  map[string]*object.Module // imported files by absolute path
+	loading  []*object.Module          // files being imported, outermost first
+	importer string                    // file of the program that started the imports
+
+	usage object.Usage // of the program being evaluated, checked against Limits
+}
+
+func New() *Evaluator {
+	return &Evaluator{Output: os.Stdout, MaxCallDepth: DefaultMaxCallDepth}
+}
+
+// EvaluateProgram evaluates statements with a default evaluator
 func EvaluateProgram(statements []ast.Statement, env *object.Environment) []object.Object {
-	var program []object.Object
+	return New().EvaluateProgram(statements, env)
+}
+
+// Evaluate evaluates node with a default evaluator
+func Evaluate(node ast.Node, env *object.Environment) object.Object {
+	return New().Evaluate(node, env)
+}
+
+// Evaluate resolves the variables of node, node being taken for a statement of
+// the program env holds the globals of, then evaluates it
+func (e *Evaluator) Evaluate(node ast.Node, env *object.Environment) object.Object {
+	var statements []ast.Statement
+	switch node := node.(type) {
+	case ast.Statement:
+		statements = []ast.Statement{node}
+	case ast.Expression:
+		statements = []ast.Statement{&ast.ExpressionStatement{Expression: node}}
+	}
+	if err := resolver.Resolve(statements, env); err != nil {
+		return err
+	}
+	return e.evaluate(node, env)
+}
+
+// EvaluateProgram resolves the variables of statements, then evaluates them one
+// after the other and stops at the first return or error. A Go panic caused by a bug of the interpreter doesn't crash
+// the host, it ends the program with an internal error instead
+func (e *Evaluator) EvaluateProgram(statements []ast.Statement, env *object.Environment) []object.Object {
+	return e.EvaluateProgramContext(context.Background(), statements, env)
+}
+
+func (e *Evaluator) evaluateStatements(statements []ast.Statement, env *object.Environment) (program []object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			e.frames = nil
+			e.tryDepth = 0
+			e.tailCall = nil
+			program = append(program, newErr("internal error: %v", r))
+		}
+	}()
 
 	for _, stmt := range statements {
-		stmtVal := Evaluate(stmt, env)
+		stmtVal := e.evaluate(stmt, env)
 
 		switch stmtVal := stmtVal.(type) {
 		case *object.Return:
-			program = append(program, Evaluate(stmt, env))
+			program = append(program, stmtVal)
 			return program
 		case *object.BlockObject:
+			if err, ok := blockSignal(stmtVal).(*object.Error); ok {
+				// the error raised in the block is the outcome of the program
+				program = append(program, err)
+				return program
+			}
+			program = append(program, stmtVal)
 			if stmtVal.Return {
-				program = append(program, stmtVal)
 				return program
-			} else {
-				program = append(program, stmtVal)
 			}
 		case *object.Error:
 			program = append(program, stmtVal)
@@ -42,10 +126,10 @@ func EvaluateProgram(statements []ast.Statement, env *object.Environment) []obje
 	return program
 }
 
-func EvaluateBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+func (e *Evaluator) evaluateBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	res := object.BlockObject{Return: false}
 	for _, stmt := range block.Statements {
-		stmtVal := Evaluate(stmt, env)
+		stmtVal := e.evaluate(stmt, env)
 
 		switch stmtVal := stmtVal.(type) {
 		case *object.Return:
@@ -60,12 +144,12 @@ func EvaluateBlockStatement(block *ast.BlockStatement, env *object.Environment)
 			} else {
 				res.Block = append(res.Block, stmtVal)
 			}
-		case *object.Error:
+		case *object.Error, *object.Break, *object.Continue:
 			res.Block = append(res.Block, stmtVal)
 			res.Return = true
 			return &res
 		default:
-			res.Block = append(res.Block, Evaluate(stmt, env))
+			res.Block = append(res.Block, stmtVal)
 		}
 
 	}
@@ -73,53 +157,410 @@ func EvaluateBlockStatement(block *ast.BlockStatement, env *object.Environment)
 	return &res
 }
 
-func Evaluate(node ast.Node, env *object.Environment) object.Object {
+// evaluate evaluates node, an error raised by node itself rather than by one of
+// its children gets the position of node and the current call stack
+func (e *Evaluator) evaluate(node ast.Node, env *object.Environment) object.Object {
+	var result object.Object
+	if err := e.usage.Step(); err != nil {
+		result = err
+	} else {
+		result = e.evaluateNode(node, env)
+	}
+
+	switch node.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.FunctionLiteral, *ast.ArrayLiteral,
+		*ast.HashLiteral, *ast.PrefixExpression, *ast.InfixExpression, *ast.SliceExpression, *ast.RangeExpression:
+		result = e.usage.Allocate(result)
+	}
+
+	if err, ok := result.(*object.Error); ok && err.Line == 0 {
+		if positioned, ok := node.(interface{ GetToken() token.Token }); ok {
+			e.locate(err, positioned.GetToken())
+		}
+	}
+	return result
+}
+
+// locate records in err the position of tok and the functions being called
+func (e *Evaluator) locate(err *object.Error, tok token.Token) {
+	err.File = tok.File
+	err.Line = tok.Line
+	err.Column = tok.Column
+	err.Stack = make([]object.Frame, 0, len(e.frames))
+	for i := len(e.frames) - 1; i >= 0; i-- {
+		err.Stack = append(err.Stack, e.frames[i])
+	}
+}
+
+func (e *Evaluator) evaluateNode(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.LetStatement:
-		val := Evaluate(node.Value, env)
-		env.Set(node.Name.Value, val)
+		val := e.evaluate(node.Value, env)
+		if interrupts(val) {
+			return val
+		}
+		if node.Name.Local {
+			env.SetSlot(node.Name.Depth, node.Name.Index, val)
+		} else {
+			env.SetGlobal(node.Name.Index, val)
+		}
+	case *ast.ImportStatement:
+		mod := e.importModule(node)
+		if interrupts(mod) {
+			return mod
+		}
+		if node.Name.Local {
+			env.SetSlot(node.Name.Depth, node.Name.Index, mod)
+		} else {
+			env.SetGlobal(node.Name.Index, mod)
+		}
 	case *ast.AssignementStatement:
-    val := Evaluate(node.Value, env)
-    env.Set(node.Name.Value, val)
+		val := e.evaluate(node.Value, env)
+		if interrupts(val) {
+			return val
+		}
+		return assign(node.Name, val, env)
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.ExpressionStatement:
-		return Evaluate(node.Expression, env)
+		// an if statement keeps its block, whose return, break or continue
+		// stops the statements around it
+		if ifExpression, ok := node.Expression.(*ast.IfExpression); ok {
+			return e.evaluateIfExpression(ifExpression, env)
+		}
+		return e.evaluate(node.Expression, env)
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		return &object.Integer{Value: node.Value, Big: node.Big}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
 	case *ast.Boolean:
-		return boolToBoolObject(node.Value)
+		return object.BoolObject(node.Value)
 	case *ast.PrefixExpression:
-		return evaluatePrefix(node, env)
+		return e.evaluatePrefix(node, env)
 	case *ast.IfExpression:
-		return evaluateIfExpression(node, env)
+		return ifValue(e.evaluateIfExpression(node, env))
 	case *ast.InfixExpression:
-		return evaluateInfixExpression(node, env)
+		return e.evaluateInfixExpression(node, env)
 	case *ast.BlockStatement:
-		return EvaluateBlockStatement(node, env)
+		return e.evaluateBlockStatement(node, object.NewEnclosedEnvironment(env))
+	case *ast.WhileStatement:
+		return e.evaluateWhileStatement(node, env)
+	case *ast.ForStatement:
+		return e.evaluateForStatement(node, env)
+	case *ast.ForInStatement:
+		return e.evaluateForInStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 	case *ast.ReturnStatement:
-		return &object.Return{Value: Evaluate(node.Value, env)}
+		// the frame of the function can be dropped before calling the returned
+		// call, unless a try block needs to see what the call raises
+		if call, ok := node.Value.(*ast.CallExpression); ok && len(e.frames) > 0 && e.tryDepth == 0 {
+			e.tailCall = call
+		}
+		val := e.evaluate(node.Value, env)
+		if interrupts(val) {
+			return val
+		}
+		return &object.Return{Value: val}
+	case *ast.PrintStatement:
+		return e.evaluatePrintStatement(node, env)
+	case *ast.ThrowStatement:
+		val := e.evaluate(node.Value, env)
+		if interrupts(val) {
+			return val
+		}
+		return object.ThrownError(val)
+	case *ast.TryStatement:
+		return e.evaluateTryStatement(node, env)
+	case *ast.FunctionLiteral:
+		return &object.Function{Name: node.Name, Parameters: node.Parameters, Body: &node.Body, Env: env}
+	case *ast.ArrayLiteral:
+		elements := e.evaluateExpressions(node.Elements, env)
+		if len(elements) == 1 && interrupts(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+	case *ast.HashLiteral:
+		return e.evaluateHashLiteral(node, env)
+	case *ast.IndexExpression:
+		left := e.evaluate(node.Left, env)
+		if interrupts(left) {
+			return left
+		}
+		index := e.evaluate(node.Index, env)
+		if interrupts(index) {
+			return index
+		}
+		return object.Index(left, index)
+	case *ast.SliceExpression:
+		return e.evaluateSliceExpression(node, env)
+	case *ast.RangeExpression:
+		return e.evaluateRangeExpression(node, env)
+	case *ast.MemberExpression:
+		return e.evaluateMemberExpression(node, env)
+	case *ast.CallExpression:
+		tail := e.tailCall == node
+		e.tailCall = nil
+		function := e.evaluate(node.Function, env)
+		if interrupts(function) {
+			return function
+		}
+		args := e.evaluateExpressions(node.Arguments, env)
+		if len(args) == 1 && interrupts(args[0]) {
+			return args[0]
+		}
+		if fn, ok := function.(*object.Function); ok && tail && len(args) == len(fn.Parameters) {
+			return &object.TailCall{Function: fn, Arguments: args, Call: node.Token}
+		}
+		return e.applyFunction(function, args, node.Token)
 	}
 
 	return nil
 }
 
-func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
-	val, ok := env.Get(node.Value)
+// evaluateTryStatement runs the catch block when the body stops on an error and
+// then always runs the finally block. Leaving the finally block with a return,
+// break, continue or error takes precedence over the outcome of the try
+func (e *Evaluator) evaluateTryStatement(node *ast.TryStatement, env *object.Environment) object.Object {
+	e.tryDepth++
+	defer func() { e.tryDepth-- }()
+
+	result := e.evaluateBlockStatement(node.Body, object.NewEnclosedEnvironment(env))
+
+	if err, ok := blockSignal(result).(*object.Error); ok && !err.Fatal && node.Catch != nil {
+		catchEnv := object.NewEnclosedEnvironment(env)
+		catchEnv.SetSlot(0, node.CatchParam.Index, object.ErrorToHash(err))
+		result = e.evaluateBlockStatement(node.Catch, catchEnv)
+	}
+
+	if err, ok := blockSignal(result).(*object.Error); ok && err.Fatal {
+		// the program has to stop, even the finally block is skipped
+		return result
+	}
+
+	if node.Finally != nil {
+		finally := e.evaluateBlockStatement(node.Finally, object.NewEnclosedEnvironment(env))
+		if blockSignal(finally) != nil {
+			return finally
+		}
+	}
+
+	return result
+}
+
+// evaluatePrintStatement writes its arguments separated by spaces on a line of e.Output
+func (e *Evaluator) evaluatePrintStatement(node *ast.PrintStatement, env *object.Environment) object.Object {
+	args := e.evaluateExpressions(node.Arguments, env)
+	if len(args) == 1 && interrupts(args[0]) {
+		return args[0]
+	}
+
+	if err := object.Print(e.Output, args); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (e *Evaluator) evaluateExpressions(exprs []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+
+	for _, expr := range exprs {
+		evaluated := e.evaluate(expr, env)
+		if interrupts(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+func (e *Evaluator) evaluateHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+
+	for i, keyNode := range node.Keys {
+		key := e.evaluate(keyNode, env)
+		if interrupts(key) {
+			return key
+		}
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newErr("unusable as hash key: %s", key.Type())
+		}
+
+		value := e.evaluate(node.Values[i], env)
+		if interrupts(value) {
+			return value
+		}
+
+		hash.Set(hashKey, value)
+	}
+
+	return hash
+}
+
+func (e *Evaluator) evaluateRangeExpression(node *ast.RangeExpression, env *object.Environment) object.Object {
+	bounds := e.evaluateExpressions([]ast.Expression{node.Start, node.End}, env)
+	if len(bounds) == 1 && interrupts(bounds[0]) {
+		return bounds[0]
+	}
+	var step object.Object = &object.Integer{Value: 1}
+	if node.Step != nil {
+		step = e.evaluate(node.Step, env)
+		if interrupts(step) {
+			return step
+		}
+	}
+	return object.NewRange(bounds[0], bounds[1], step, node.Inclusive)
+}
+
+func (e *Evaluator) evaluateSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := e.evaluate(node.Left, env)
+	if interrupts(left) {
+		return left
+	}
+	start, err := e.evaluateSliceBound(node.Start, env)
+	if err != nil {
+		return err
+	}
+	end, err := e.evaluateSliceBound(node.End, env)
+	if err != nil {
+		return err
+	}
+	return object.Slice(left, start, end)
+}
+
+// evaluateSliceBound evaluates one of the bounds of a slice, an omitted bound gives nil
+func (e *Evaluator) evaluateSliceBound(bound ast.Expression, env *object.Environment) (object.Object, object.Object) {
+	if bound == nil {
+		return nil, nil
+	}
+	val := e.evaluate(bound, env)
+	if interrupts(val) {
+		return nil, val
+	}
+	return val, nil
+}
+
+// applyFunction calls fn with args, call is the token where the call happens.
+// The tail calls returned by the function are made in a loop so that they don't
+// grow the stack
+func (e *Evaluator) applyFunction(fn object.Object, args []object.Object, call token.Token) object.Object {
+	if builtin, ok := fn.(*object.Builtin); ok {
+		if result := builtin.Call(e.usage.Budget, args...); result != nil {
+			return e.usage.Allocate(result)
+		}
+		return NULL
+	}
+
+	function, ok := fn.(*object.Function)
 	if !ok {
+		return newErr("not a function: %s", fn.Type())
+	}
+
+	if len(args) != len(function.Parameters) {
+		return newErr("wrong number of arguments: expected %d, got %d", len(function.Parameters), len(args))
+	}
+	if e.MaxCallDepth > 0 && len(e.frames) >= e.MaxCallDepth {
+		return newErr("stack overflow: more than %d nested calls", e.MaxCallDepth)
+	}
+
+	tryDepth := e.tryDepth
+	e.tryDepth = 0
+	defer func() { e.tryDepth = tryDepth }()
+
+	for {
+		env := object.NewEnclosedEnvironment(function.Env)
+		for i, param := range function.Parameters {
+			env.SetSlot(0, param.Index, args[i])
+		}
+
+		e.frames = append(e.frames, object.Frame{Function: function.Name, File: call.File, Line: call.Line, Column: call.Column})
+		evaluated := e.evaluateBlockStatement(function.Body, env)
+		e.frames = e.frames[:len(e.frames)-1]
+
+		result := unwrapReturnValue(evaluated)
+		tail, ok := result.(*object.TailCall)
+		if !ok {
+			return result
+		}
+		// only calls of functions with the right number of arguments are made tail calls
+		function, args, call = tail.Function.(*object.Function), tail.Arguments, tail.Call
+	}
+}
+
+// unwrapReturnValue extracts the value produced by a function body: either the
+// value of the return statement that stopped it or the value of its last statement
+func unwrapReturnValue(obj object.Object) object.Object {
+	switch obj := obj.(type) {
+	case *object.Return:
+		return obj.Value
+	case *object.BlockObject:
+		if len(obj.Block) == 0 {
+			return NULL
+		}
+		return unwrapReturnValue(obj.Block[len(obj.Block)-1])
+	case nil:
+		return NULL
+	}
+
+	return obj
+}
+
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if node.Local {
+		if val := env.GetSlot(node.Depth, node.Index); val != nil {
+			return val
+		}
+		// a function using a variable of an enclosing scope declared after it
+		// was called before the declaration
 		return newErr("identifier not found: %v", node.Value)
 	}
-	return val
+
+	if val := env.GetGlobal(node.Index); val != nil {
+		return val
+	}
+	if builtin := object.GetBuiltinByName(node.Value); builtin != nil {
+		return builtin
+	}
+	return newErr("identifier not found: %v", node.Value)
+}
+
+// assign updates the variable name, which has to be declared already
+func assign(name *ast.Identifier, val object.Object, env *object.Environment) object.Object {
+	if !name.Local {
+		if env.GetGlobal(name.Index) == nil {
+			return newErr("assignment to undeclared variable: %s", name.Value)
+		}
+		env.SetGlobal(name.Index, val)
+		return nil
+	}
+
+	if env.GetSlot(name.Depth, name.Index) == nil {
+		return newErr("assignment to undeclared variable: %s", name.Value)
+	}
+	env.SetSlot(name.Depth, name.Index, val)
+	return nil
 }
 
-func evaluateIfExpression(node *ast.IfExpression, env *object.Environment) object.Object {
-	resCondition := Evaluate(node.Condition, env)
-	cond := boolToBoolObject(resCondition == TRUE)
+func (e *Evaluator) evaluateIfExpression(node *ast.IfExpression, env *object.Environment) object.Object {
+	resCondition := e.evaluate(node.Condition, env)
+	if interrupts(resCondition) {
+		return resCondition
+	}
+	cond, err := e.isTruthy(resCondition, "condition")
+	if err != nil {
+		return err
+	}
 
-	if cond.Value {
-		return EvaluateBlockStatement(node.Consequences, env)
+	if cond {
+		return e.evaluateBlockStatement(node.Consequences, object.NewEnclosedEnvironment(env))
 	} else {
-		consequences := EvaluateBlockStatement(node.ElseConsequences, env)
+		consequences := e.evaluateBlockStatement(node.ElseConsequences, object.NewEnclosedEnvironment(env))
 		if node.ElseConsequences == nil {
 			return nil
 		}
@@ -127,97 +568,219 @@ func evaluateIfExpression(node *ast.IfExpression, env *object.Environment) objec
 	}
 }
 
-func evaluatePrefix(node *ast.PrefixExpression, env *object.Environment) object.Object {
-	right := Evaluate(node.Right, env)
-	if node.Operator == "!" {
-		return evaluateBangOperatorExpression(right)
-	} else if node.Operator == "-" {
-		return evaluateMinusOperatorExpression(right)
-	} else {
-		return newErr("unknown operator: %s", node.Operator)
-		return nil
+// ifValue gives the value of an if used as an expression: the value of the
+// last statement of the block it ran, or what interrupted the block
+func ifValue(obj object.Object) object.Object {
+	if signal := blockSignal(obj); signal != nil {
+		return signal
 	}
+	return unwrapReturnValue(obj)
 }
 
-func evaluateMinusOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
-		return newErr("unknown operator: -%v", right.Type())
-		return NULL
+func (e *Evaluator) evaluateWhileStatement(node *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := e.evaluate(node.Condition, env)
+		if interrupts(condition) {
+			return condition
+		}
+		cond, err := e.isTruthy(condition, "condition")
+		if err != nil {
+			return err
+		}
+		if !cond {
+			return nil
+		}
+
+		result := e.evaluateBlockStatement(node.Instructions, object.NewEnclosedEnvironment(env))
+		switch signal := blockSignal(result).(type) {
+		case nil, *object.Continue:
+		case *object.Break:
+			return nil
+		default:
+			return signal
+		}
 	}
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
-func evaluateBangOperatorExpression(right object.Object) object.Object {
-	switch right {
-	case TRUE:
-		return FALSE
-	case FALSE:
-		return TRUE
-	default:
-		return newErr("unknown operator : !%v", right.Type())
-		return NULL
+// evaluateForStatement runs the initialization in an environment of its own,
+// shared by every iteration, then the body and the update while the condition,
+// true when left out, holds
+func (e *Evaluator) evaluateForStatement(node *ast.ForStatement, env *object.Environment) object.Object {
+	loopEnv := object.NewEnclosedEnvironment(env)
+	if node.Init != nil {
+		if init := e.evaluate(node.Init, loopEnv); interrupts(init) {
+			return init
+		}
+	}
+
+	for {
+		if node.Condition != nil {
+			condition := e.evaluate(node.Condition, loopEnv)
+			if interrupts(condition) {
+				return condition
+			}
+			cond, err := e.isTruthy(condition, "condition")
+			if err != nil {
+				return err
+			}
+			if !cond {
+				return nil
+			}
+		}
+
+		result := e.evaluateBlockStatement(node.Body, object.NewEnclosedEnvironment(loopEnv))
+		switch signal := blockSignal(result).(type) {
+		case nil, *object.Continue:
+		case *object.Break:
+			return nil
+		default:
+			return signal
+		}
+
+		if node.Update != nil {
+			if update := e.evaluate(node.Update, loopEnv); interrupts(update) {
+				return update
+			}
+		}
 	}
 }
 
-func boolToBoolObject(b bool) *object.Boolean {
-	if b {
-		return TRUE
-	}
-	return FALSE
-}
-
-func evaluateIntegerInfixExpression(operator string, left, right object.Object) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
-	switch operator {
-	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
-	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
-	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
-	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
-	case "==":
-		return boolToBoolObject(leftVal == rightVal)
-	case "!=":
-		return boolToBoolObject(leftVal != rightVal)
-	case ">":
-		return boolToBoolObject(leftVal > rightVal)
-	case ">=":
-		return boolToBoolObject(leftVal >= rightVal)
-	case "<":
-		return boolToBoolObject(leftVal < rightVal)
-	case "<=":
-		return boolToBoolObject(leftVal <= rightVal)
-
-	default:
-		return NULL
+// evaluateForInStatement runs the body once per element of the iterable, in a
+// new environment every time so that the closures created by an iteration keep
+// its variables
+func (e *Evaluator) evaluateForInStatement(node *ast.ForInStatement, env *object.Environment) object.Object {
+	iterable := e.evaluate(node.Iterable, env)
+	if interrupts(iterable) {
+		return iterable
+	}
+	it, err := object.Iterate(iterable)
+	if err != nil {
+		return err
+	}
+
+	for {
+		key, value, ok := it.Next()
+		if !ok {
+			return nil
+		}
+
+		iterEnv := object.NewEnclosedEnvironment(env)
+		if len(node.Variables) == 1 {
+			iterEnv.SetSlot(0, node.Variables[0].Index, it.Element(key, value))
+		} else {
+			iterEnv.SetSlot(0, node.Variables[0].Index, key)
+			iterEnv.SetSlot(0, node.Variables[1].Index, value)
+		}
+
+		result := e.evaluateBlockStatement(node.Body, iterEnv)
+		switch signal := blockSignal(result).(type) {
+		case nil, *object.Continue:
+		case *object.Break:
+			return nil
+		default:
+			return signal
+		}
 	}
 }
 
-func evaluateInfixExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
-	left := Evaluate(node.Left, env)
-	right := Evaluate(node.Right, env)
+// blockSignal returns the value that interrupted a block (return, error, break or
+// continue), or nil if the block ran to completion
+func blockSignal(obj object.Object) object.Object {
+	block, ok := obj.(*object.BlockObject)
+	if !ok || !block.Return {
+		return nil
+	}
 
-	switch {
-	case left.Type() != right.Type():
-		return newErr("type mismatch: %s%s%s", left.Type(), node.Operator, right.Type())
-		return &object.Null{}
-	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evaluateIntegerInfixExpression(node.Operator, left, right)
-	case node.Operator == "==":
-		return boolToBoolObject(left == right)
-	case node.Operator == "!=":
-		return boolToBoolObject(left != right)
-	default:
-		return newErr("unknown operator: %v%v%v", left.Type(), node.Operator, right.Type())
+	last := block.Block[len(block.Block)-1]
+	if inner, ok := last.(*object.BlockObject); ok {
+		return blockSignal(inner)
 	}
+	return last
+}
 
-	return NULL
+func (e *Evaluator) evaluatePrefix(node *ast.PrefixExpression, env *object.Environment) object.Object {
+	right := e.evaluate(node.Right, env)
+	if interrupts(right) {
+		return right
+	}
+	if node.Operator == "!" {
+		truthy, err := e.isTruthy(right, "operand of !")
+		if err != nil {
+			return err
+		}
+		return object.BoolObject(!truthy)
+	}
+	return object.PrefixOperator(node.Operator, right)
+}
+
+// isTruthy tells whether obj counts as true according to e.Truthiness, in strict
+// mode what describes obj in the error reported for a value that isn't a boolean
+func (e *Evaluator) isTruthy(obj object.Object, what string) (bool, object.Object) {
+	truthy, err := object.Truthy(obj, e.Truthiness, what)
+	if err != nil {
+		return false, err
+	}
+	return truthy, nil
+}
+
+func (e *Evaluator) evaluateInfixExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := e.evaluate(node.Left, env)
+	if interrupts(left) {
+		return left
+	}
+
+	if node.Operator == "&&" || node.Operator == "||" {
+		return e.evaluateLogicalExpression(node, left, env)
+	}
+
+	right := e.evaluate(node.Right, env)
+	if interrupts(right) {
+		return right
+	}
+	return object.InfixOperator(node.Operator, left, right)
+}
+
+// evaluateLogicalExpression short-circuits: the right operand is only evaluated
+// when the left one doesn't decide the result on its own. The result is always
+// a boolean, the truthiness of the operand that decided it
+func (e *Evaluator) evaluateLogicalExpression(node *ast.InfixExpression, left object.Object, env *object.Environment) object.Object {
+	what := "operand of " + node.Operator
+	leftVal, err := e.isTruthy(left, what)
+	if err != nil {
+		return err
+	}
+	if (node.Operator == "&&" && !leftVal) || (node.Operator == "||" && leftVal) {
+		return object.BoolObject(leftVal)
+	}
+
+	right := e.evaluate(node.Right, env)
+	if interrupts(right) {
+		return right
+	}
+	rightVal, err := e.isTruthy(right, what)
+	if err != nil {
+		return err
+	}
+	return object.BoolObject(rightVal)
 }
 
 func newErr(format string, a ...interface{}) object.Object {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
+
+func isError(obj object.Object) bool {
+	if obj != nil {
+		return obj.Type() == object.ERROR_OBJ
+	}
+	return false
+}
+
+// interrupts tells whether obj stops the evaluation of the expression it comes
+// from: an error, or the return, break or continue ending an if used as a value
+func interrupts(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Error, *object.Return, *object.Break, *object.Continue:
+		return true
+	}
+	return false
+}
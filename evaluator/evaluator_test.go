@@ -1,11 +1,19 @@
 package evaluator
 
 import (
+	"bytes"
+	"context"
+	"math"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/tysufa/qfa/ast"
 	"github.com/tysufa/qfa/lexer"
 	"github.com/tysufa/qfa/object"
 	"github.com/tysufa/qfa/parser"
+	"github.com/tysufa/qfa/testutil"
 )
 
 func TestLetStatements(t *testing.T) {
@@ -24,7 +32,7 @@ func TestLetStatements(t *testing.T) {
     evaluationRes := testEval(tt.input)
     for _, res := range evaluationRes{
       if res != nil{
-        testIntegerObject(t, res, tt.expected)
+        testutil.Integer(t, res, tt.expected)
       }
     }
 	}
@@ -47,6 +55,22 @@ func TestErrors(t *testing.T) {
 			"-true",
 			"unknown operator: -BOOLEAN",
 		},
+		{
+			"if (true) { let y = 1 / 0; } 5;",
+			"division by zero",
+		},
+		{
+			"try { throw 1; } finally {}",
+			"1",
+		},
+		{
+			`try { throw 1; } catch (e) { throw "again"; } 5;`,
+			"again",
+		},
+		{
+			"while (true) { if (true) { x; } }",
+			"identifier not found: x",
+		},
 		{
 			"true + false;",
 			"unknown operator: BOOLEAN+BOOLEAN",
@@ -94,25 +118,24 @@ func TestErrors(t *testing.T) {
 func TestIfExpression(t *testing.T) {
 	tests := []struct {
 		input    string
-		expected int
+		expected interface{}
 	}{
 		// {"if (1+2 == 4){3*2} else {3+2*4}", 11},
 		// {"if (true){if (true) {return 1;} 5} else {3+2*4}", 1},
+		{"let x = if (true) { 5 } else { 6 }; x + 1;", 6},
+		{"let x = if (false) { 5 } else { 6 }; x + 1;", 7},
+		{"type(if (true) { 1 })", "INTEGER"},
+		{"str([if (false) { 1 }])", "[null]"},
+		{"let x = if (true) { let a = 1; }; x;", nil},
+		{"1 + if (true) { if (false) { 1 } else { 2 } };", 3},
+		{"let f = fn() { let x = if (true) { return 5; }; 7 }; f();", 5},
+		{"let f = fn() { 1 + if (true) { return 5; } }; f();", 5},
+		{"let s = 0; while (true) { let x = if (true) { break; }; s = 1; } s;", 0},
+		{"let x = if (true) { 1 / 0 }; 2;", "division by zero"},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
-		testIntegerObject(t, evaluated[0], tt.expected)
-	}
-}
-
-func testIntegerObject(t *testing.T, obj object.Object, res int) {
-	result, ok := obj.(*object.Integer)
-	if !ok {
-		t.Errorf("object is not Integer. got=%T", obj)
-	}
-	if result.Value != res {
-		t.Errorf("object has wrong value. got=%d, want=%d",
-			result.Value, res)
+		testutil.Object(t, evaluated[len(evaluated)-1], tt.expected)
 	}
 }
 
@@ -139,17 +162,1532 @@ func TestIntegerEvaluation(t *testing.T) {
 
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
-		testIntegerObject(t, evaluated[0], tt.expected)
+		testutil.Integer(t, evaluated[0], tt.expected)
 	}
 }
 
-func testEval(input string) []object.Object {
-	l := lexer.New(input)
-	p := parser.New(l)
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
 
-	program := p.GetStatements()
+	evaluated := testEval(input)
+	fn, ok := evaluated[0].(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated[0], evaluated[0])
+	}
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v", fn.Parameters)
+	}
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	}
+	if fn.Body.String() != "(x+2)" {
+		t.Fatalf("body is not %q. got=%q", "(x+2)", fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { return x + y; }; add(1, 2);", 3},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+		{"let f = fn(x) { if (x > 1) { return 1; } return 2; }; f(3);", 1},
+		{"let f = fn(x) { if (x > 1) { return 1; } return 2; }; f(0);", 2},
+		{"let f = fn(x) { if (x > 1) { if (true) { return 3; } } return 2; }; f(2);", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testutil.Integer(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{`
+let newAdder = fn(x) {
+	return fn(y) { return x + y; };
+};
+let addTwo = newAdder(2);
+addTwo(3);`, 5},
+		{`
+let apply = fn(f, x) { return f(x); };
+apply(fn(x) { return x * 3; }, 4);`, 12},
+		{`
+let compose = fn(f, g) { return fn(x) { return g(f(x)); }; };
+let inc = fn(x) { return x + 1; };
+let double = fn(x) { return x * 2; };
+compose(inc, double)(4);`, 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testutil.Integer(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{`
+let fact = fn(n) {
+	if (n == 0) { return 1; }
+	return n * fact(n - 1);
+};
+fact(5);`, 120},
+		{`
+let fib = fn(n) {
+	if (n < 2) { return n; }
+	return fib(n - 1) + fib(n - 2);
+};
+fib(10);`, 55},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testutil.Integer(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+}
+
+func TestFunctionErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"let add = fn(x, y) { x + y; }; add(1);", "wrong number of arguments: expected 2, got 1"},
+		{"let add = fn(x, y) { x + y; }; add(1, 2, 3);", "wrong number of arguments: expected 2, got 3"},
+		{"let x = 5; x(1);", "not a function: INTEGER"},
+		{"let f = fn() { return y; }; f();", "identifier not found: y"},
+		{"let f = fn(x) { x + true; }; f(1) + 2;", "type mismatch: INTEGER+BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated[len(evaluated)-1].(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T", tt.input, evaluated[len(evaluated)-1])
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestWhileStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"let i = 0; let sum = 0; while (i < 5) { sum = sum + i; i = i + 1; } sum;", 10},
+		{"let i = 0; while (false) { i = i + 1; } i;", 0},
+		{"let i = 0; while (true) { if (i == 3) { break; } i = i + 1; } i;", 3},
+		{`
+let i = 0;
+let sum = 0;
+while (i < 10) {
+	i = i + 1;
+	if (i > 5) { continue; }
+	sum = sum + i;
+}
+sum;`, 15},
+		{`
+let i = 0;
+let count = 0;
+while (i < 3) {
+	let j = 0;
+	while (true) {
+		if (j == 2) { break; }
+		j = j + 1;
+		count = count + 1;
+	}
+	i = i + 1;
+}
+count;`, 6},
+		{`
+let f = fn() {
+	let i = 0;
+	while (true) {
+		if (i == 4) { return i; }
+		i = i + 1;
+	}
+};
+f();`, 4},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testutil.Integer(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+}
+
+func TestWhileErrors(t *testing.T) {
+	evaluated := testEval("while (true) { x; }")
+	errObj, ok := evaluated[len(evaluated)-1].(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T", evaluated[len(evaluated)-1])
+	}
+	if errObj.Message != "identifier not found: x" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"let sum = 0; for (let i = 0; i < 5; i = i + 1) { sum = sum + i; } sum;", 10},
+		{"let i = 0; for (; i < 3; ) { i = i + 1; } i;", 3},
+		{"let i = 10; for (i = 0; i < 4; i = i + 1) {} i;", 4},
+		{"let i = 0; for (;;) { if (i == 3) { break; } i = i + 1; } i;", 3},
+		{"let sum = 0; for (let i = 0; i < 10; i = i + 1) { if (i % 2 == 0) { continue; } sum = sum + i; } sum;", 25},
+		{"let i = 7; for (let i = 0; i < 3; i = i + 1) { let x = i; } i;", 7},
+		{`
+let count = 0;
+for (let i = 0; i < 3; i = i + 1) {
+	for (let j = 0; j < 3; j = j + 1) {
+		if (j == i) { break; }
+		count = count + 1;
+	}
+}
+count;`, 3},
+		{`
+let f = fn(n) {
+	for (let i = 0; true; i = i + 1) {
+		if (i * i >= n) { return i; }
+	}
+};
+f(50);`, 8},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testutil.Integer(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+}
+
+func TestForInStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let sum = 0; for (x in [1, 2, 3]) { sum = sum + x; } sum;", 6},
+		{"let sum = 0; for (i, x in [5, 6, 7]) { sum = sum + i * x; } sum;", 20},
+		{`let s = ""; for (c in "héllo") { s = c + s; } s;`, "olléh"},
+		{`let s = ""; for (i, c in "abc") { s = s + c + str(i); } s;`, "a0b1c2"},
+		{`let s = ""; for (k in {"a": 1, "b": 2}) { s = s + k; } s;`, "ab"},
+		{`let s = ""; for (k, v in {"a": 1, "b": 2}) { s = s + k + str(v); } s;`, "a1b2"},
+		{"let sum = 0; for (i in 5) { sum = sum + i; } sum;", 10},
+		{"let n = 0; for (i in -3) { n = n + 1; } n;", 0},
+		{"let n = 0; for (x in []) { n = n + 1; } n;", 0},
+		{"let x = 1; for (x in [5]) {} x;", 1},
+		{"let n = 0; for (x in [1, 0, 2]) { try { n = n + 10 / x; } catch (e) { n = n + 100; } } n;", 115},
+		{"let n = 0; for (x in [1, 2, 3]) { try { if (x == 2) { break; } } finally { n = n + x; } } n;", 3},
+		{"let n = 0; try { for (x in [1, 2]) { n = n + x; throw n; } } catch (e) { n = n * 10; } n;", 10},
+		{"let sum = 0; for (x in [1, 2, 3, 4]) { if (x == 3) { break; } sum = sum + x; } sum;", 3},
+		{"let sum = 0; for (x in [1, 2, 3, 4]) { if (x == 3) { continue; } sum = sum + x; } sum;", 7},
+		{`
+let fns = [];
+for (x in [1, 2, 3]) {
+	fns = push(fns, fn() { x * 10 });
+}
+fns[0]() + fns[2]();`, 40},
+		{`
+let pairs = 0;
+for (i in [1, 2, 3]) {
+	for (j in [1, 2, 3]) {
+		if (j > i) { continue; }
+		let p = i * j;
+		pairs = pairs + 1;
+	}
+}
+pairs;`, 6},
+		{`
+let find = fn(a, y) {
+	for (i, x in a) {
+		if (x == y) { return i; }
+	}
+	return -1;
+};
+find([4, 5, 6], 6) * 10 + find([1], 9);`, 19},
+		{"for (x in true) {}", "not iterable: BOOLEAN"},
+		{"for (x in 1.5) {}", "not iterable: FLOAT"},
+		{"for (x in [1]) { y; }", "identifier not found: y"},
+		{"for (x in z) {}", "identifier not found: z"},
+		{"for (let i = 0; i < 1; i = i + 1) {} i;", "identifier not found: i"},
+		{"for (x in [1]) {} x;", "identifier not found: x"},
+		{"for (i in 100000000000000000000) {}", "range bound too large: 100000000000000000000"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testutil.Object(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+}
+
+func TestRanges(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let sum = 0; for (i in 1..5) { sum = sum + i; } sum;", 10},
+		{"let sum = 0; for (i in 1..=5) { sum = sum + i; } sum;", 15},
+		{"let sum = 0; for (i in 0..10 step 3) { sum = sum + i; } sum;", 18},
+		{"let sum = 0; for (i in 10..0 step -3) { sum = sum + i; } sum;", 22},
+		{"let sum = 0; for (i in 9..=0 step -3) { sum = sum + i; } sum;", 18},
+		{"let sum = 0; for (k, v in 5..8) { sum = sum + k * v; } sum;", 20},
+		{"let n = 0; for (i in 5..5) { n = n + 1; } n;", 0},
+		{"let n = 0; for (i in 5..=5) { n = n + 1; } n;", 1},
+		{"let n = 0; for (i in 5..0) { n = n + 1; } n;", 0},
+		{"str(1..10)", "1..10"},
+		{"str(0..=10 step 2)", "0..=10 step 2"},
+		{"type(0..1)", "RANGE"},
+		{"str(array(1..=4))", "[1, 2, 3, 4]"},
+		{"str(array(0..10 step 4))", "[0, 4, 8]"},
+		{"str(array(3..0 step -1))", "[3, 2, 1]"},
+		{"str(array(0..0))", "[]"},
+		{`str(array("ab"))`, `["a", "b"]`},
+		{`str(array({"a": 1}))`, `["a"]`},
+		{"len(0..10)", 10},
+		{"len(0..=10 step 3)", 4},
+		{"len(10..0 step -4)", 3},
+		{"len(3..1)", 0},
+		{"str(len(-9223372036854775807 - 1..=9223372036854775807))", "18446744073709551616"},
+		{"len(0..9223372036854775807 step 1000000000000000000)", 10},
+		{"(0..10 step 2)[3]", 6},
+		{"(10..=0 step -5)[2]", 0},
+		{"(-9223372036854775807 - 1..=9223372036854775807)[9223372036854775807]", -1},
+		{"(0..10)[10]", "index out of range: 10 with length 10"},
+		{"(0..10)[-1]", "negative index: -1"},
+		{"(0..10)[true]", "index must be an INTEGER, got BOOLEAN"},
+		{"3 in 0..10", true},
+		{"10 in 0..10", false},
+		{"10 in 0..=10", true},
+		{"4 in 0..10 step 3", false},
+		{"6 in 0..10 step 3", true},
+		{"-3 in 0..-10 step -3", true},
+		{"1.5 in 0..10", false},
+		{"9223372036854775807 in 0..=9223372036854775807 step 7", true},
+		{"2 in [1, 2, 3]", true},
+		{"2.0 in [1, 2, 3]", true},
+		{`"2" in [1, 2, 3]`, false},
+		{`"ell" in "hello"`, true},
+		{`"a" in {"a": 1}`, true},
+		{`"b" in {"a": 1}`, false},
+		{"1 in \"abc\"", "type mismatch: INTEGER in STRING"},
+		{"1 in 2", "unknown operator: INTEGER in INTEGER"},
+		{"[] in {}", "unusable as hash key: ARRAY"},
+		{"let step = 2; len(0..10 step step);", 5},
+		{"0..10 step 0", "range step must not be zero"},
+		{"0..1.5", "range bounds and step must be INTEGER, got FLOAT"},
+		{"0..100000000000000000000", "range bound too large: 100000000000000000000"},
+		{"array(-9223372036854775807 - 1..=9223372036854775807)", "range too large for an array: -9223372036854775808..=9223372036854775807"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testutil.Object(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+}
+
+func TestScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"let x = 1; if (true) { let x = 2; } x;", 1},
+		{"let x = 1; if (true) { x = 2; } x;", 2},
+		{"let x = 1; if (false) { 0; } else { let x = 3; x = 4; } x;", 1},
+		{"let x = 1; while (x < 3) { let y = x; x = y + 1; } x;", 3},
+		{"let x = 1; let f = fn() { x = x + 1; }; f(); f(); x;", 3},
+		{"let x = 1; let f = fn(x) { x = x + 1; }; f(5); x;", 1},
+		{`
+let counter = fn() {
+	let n = 0;
+	return fn() { n = n + 1; return n; };
+};
+let inc = counter();
+inc();
+inc();`, 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testutil.Integer(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+}
+
+func TestScopeErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"if (true) { let x = 1; } x;", "identifier not found: x"},
+		{"while (true) { let y = 1; break; } y;", "identifier not found: y"},
+		{"y = 3;", "assignment to undeclared variable: y"},
+		{"let f = fn() { z = 1; }; f();", "assignment to undeclared variable: z"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated[len(evaluated)-1].(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T", tt.input, evaluated[len(evaluated)-1])
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestResolvedScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		// functions can use the variables declared after them
+		{`
+let f = fn(n) {
+	let even = fn(n) { if (n == 0) { return 1; } return odd(n - 1); };
+	let odd = fn(n) { if (n == 0) { return 0; } return even(n - 1); };
+	even(n)
+};
+f(10);`, 1},
+		{"let f = fn() { let g = fn() { x }; let x = 4; g() }; f();", 4},
+		{"let f = fn() { g() }; let g = fn() { 5 }; f();", 5},
+		{"let f = fn(x, y) { let x = x + y; x }; f(1, 2);", 3},
+		{"let f = fn(x, x) { x }; f(1, 2);", 2},
+		{"let x = 1; let f = fn() { if (true) { let y = x; y + 1 } }; f();", 2},
+		{"let x = 1; let x = x + 1; x;", 2},
+		// the value of a let statement uses the variable it shadows
+		{"let x = 1; let y = 0; if (true) { let x = x + 1; y = x; } y * 10 + x;", 21},
+		{"let f = fn(x) { if (true) { let x = x * 2; x } }; f(4);", 8},
+		{"let x = 1; let y = 0; if (true) { let x = fn() { x }; y = type(x()); } len(y);", 8},
+		{"let n = 0; try { throw 1; } catch (e) { let m = e[\"message\"]; n = len(m); } n;", 1},
+		{`
+let fs = [];
+let i = 0;
+while (i < 3) { let j = i; fs = fs + [fn() { j }]; i = i + 1; }
+fs[0]() + fs[2]();`, 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testutil.Integer(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+}
+
+// TestUnresolvedEvaluate checks that Evaluate resolves the statements it is
+// given, which come straight from the parser
+func TestUnresolvedEvaluate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = 1; let b = 2; if (true) { let c = 3; a + b + c; } a;", 1},
+		{"let a = 1; if (true) { let c = 3; } c;", "identifier not found: c"},
+		{"let x = 1; if (true) { let x = 2; } x;", 1},
+		{"let f = fn(n) { if (n == 0) { return 0; } f(n - 1) }; f(3);", 0},
+		{"let add = fn(a, b) { let c = a + b; c }; add(2, 3);", 5},
+		{"x; let x = 1;", "identifier not found: x"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).GetStatements()
+		env := object.NewEnvironment()
+
+		var result object.Object
+		for _, stmt := range program.Statements {
+			result = Evaluate(stmt, env)
+			if isError(result) {
+				break
+			}
+		}
+		testutil.Object(t, result, tt.expected)
+	}
+}
+
+func TestImports(t *testing.T) {
+	main := testutil.ImportFiles(t)
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`import "lib/util.qfa" as u; u.double(21)`, 42},
+		// a file is run once, every import shares its globals
+		{`import "lib/util.qfa" as u; import "lib/util.qfa" as v; u.inc(); v.inc()`, 2},
+		{`import "lib/nested.qfa" as n; n.quadruple(3)`, 12},
+		{`import "found.qfa" as f; f.value`, 5},
+		{`let f = fn() { import "lib/util.qfa" as u; u.double(2) }; f()`, 4},
+		{`let m = ""; try { import "lib/failing.qfa" as f; } catch (e) { m = e["message"]; } m;`, "division by zero"},
+		{`import "nope.qfa" as n;`, "module not found: nope.qfa"},
+		{`import "lib/util.qfa" as u; u.nope`, "module lib/util.qfa has no member nope"},
+		{"let x = 1; x.y", "not a module: INTEGER"},
+		{`import "lib/cycle_a.qfa" as a;`, "import cycle: lib/cycle_a.qfa -> cycle_b.qfa -> cycle_a.qfa"},
+		{`import "main.qfa" as m;`, "import cycle: " + main + " -> main.qfa"},
+		{`import "lib/invalid.qfa" as i;`, "error in module lib/invalid.qfa: no parse function found for prefix ;"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalFile(New(), main, tt.input)
+		testutil.Object(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+
+	// an error raised by an imported file is located in it
+	evaluated := testEvalFile(New(), main, `import "lib/failing.qfa" as f;`)
+	errObj, ok := evaluated[len(evaluated)-1].(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T", evaluated[len(evaluated)-1])
+	}
+	failing := filepath.Join(filepath.Dir(main), "lib", "failing.qfa")
+	if errObj.File != failing || errObj.Line != 2 || errObj.Column != 11 {
+		t.Errorf("wrong error position. expected=%s:2:11, got=%s:%d:%d", failing, errObj.File, errObj.Line, errObj.Column)
+	}
+}
+
+func TestMathModule(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"math.pi", "3.141592653589793"},
+		{"math.e", "2.718281828459045"},
+		{"math.abs(-5)", "5"},
+		{"math.abs(-2.5)", "2.5"},
+		{"math.abs(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"math.min(3, 1.5, 2)", "1.5"},
+		{"math.max([1, 7, 3])", "7"},
+		{"math.floor(2.7)", "2"},
+		{"math.floor(-2.5)", "-3"},
+		{"math.ceil(2.1)", "3"},
+		{"math.round(2.5)", "3"},
+		{"math.round(7)", "7"},
+		{"math.floor(1e20)", "100000000000000000000"},
+		{"math.sqrt(16)", "4.0"},
+		{"math.sqrt(2 ** 200)", "1.2676506002282294e+30"},
+		{"math.pow(2, 100)", "1267650600228229401496703205376"},
+		{"math.pow(2, -1)", "0.5"},
+		{"math.log(math.e)", "1.0"},
+		{"math.log(8, 2)", "3.0"},
+		{"math.round(math.log(2 ** 2000) / math.log(2))", "2000"},
+		{"math.exp(0)", "1.0"},
+		{"math.sin(0)", "0.0"},
+		{"math.cos(math.pi)", "-1.0"},
+		{"math.atan2(1, 1) * 4", "3.141592653589793"},
+		{"math.gcd(12, -18)", "6"},
+		{"math.gcd(0, 0)", "0"},
+		{"math.lcm(4, 6)", "12"},
+		{"math.lcm(9223372036854775807, 2)", "18446744073709551614"},
+		{"math.sqrt(-1)", "math.sqrt of a negative number: -1"},
+		{"math.log(0)", "math.log of a non-positive number: 0"},
+		{"math.log(8, 1)", "math.log in base 1"},
+		{"math.min()", "math.min of no value"},
+		{`math.abs("1")`, "argument to math.abs must be INTEGER or FLOAT, got STRING"},
+		{"math.gcd(1.5, 2)", "argument to math.gcd must be INTEGER, got FLOAT"},
+		{"math.floor(1e300 * 1e300)", "could not convert +Inf to an integer"},
+		{"math.sqrt(1, 2)", "wrong number of arguments to math.sqrt: expected 1, got 2"},
+		{"math.tau", "module math has no member tau"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(`import "math" as math; ` + tt.input)
+		result := evaluated[len(evaluated)-1]
+		got := strings.TrimSuffix(result.Inspect(), "\n")
+		if err, ok := result.(*object.Error); ok {
+			got = err.Message
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestUseBeforeDeclaration(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"x; let x = 1;", 1, 1},
+		{"let x = x + 1;", 1, 9},
+		{"let f = fn() {\n  y = 2;\n  let y = 1;\n};", 2, 3},
+		{"let x = 1;\nlet f = fn() { let y = x; let x = 2; };", 2, 24},
+		{"if (true) { print(z); let z = 1; }", 1, 19},
+		{"let f = fn() { while (true) { if (a) { 1 } let a = 2; } };", 1, 35},
+		{"try { 1 } catch (e) { e; w; let w = 1; }", 1, 26},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if len(evaluated) != 1 {
+			t.Errorf("expected %q to stop before running, got %d results", tt.input, len(evaluated))
+			continue
+		}
+		errObj, ok := evaluated[0].(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T", tt.input, evaluated[0])
+			continue
+		}
+		if !strings.HasPrefix(errObj.Message, "variable used before its declaration: ") {
+			t.Errorf("wrong error message for %q. got=%q", tt.input, errObj.Message)
+		}
+		if errObj.Line != tt.expectedLine || errObj.Column != tt.expectedColumn {
+			t.Errorf("wrong position for %q. expected=%d:%d, got=%d:%d", tt.input, tt.expectedLine, tt.expectedColumn, errObj.Line, errObj.Column)
+		}
+	}
+
+	// a function called before the declaration of a variable it uses
+	evaluated := testEval("let f = fn() { let g = fn() { v }; g(); let v = 1; }; f();")
+	errObj, ok := evaluated[len(evaluated)-1].(*object.Error)
+	if !ok || errObj.Message != "identifier not found: v" {
+		t.Errorf("expected identifier not found: v, got %v", evaluated[len(evaluated)-1])
+	}
 
+	// the globals of the previous inputs of the repl are already declared
 	env := object.NewEnvironment()
+	program := parser.New(lexer.New("let r = 1;")).GetStatements()
+	EvaluateProgram(program.Statements, env)
+	program = parser.New(lexer.New("let s = r; let r = 2; s;")).GetStatements()
+	evaluated = EvaluateProgram(program.Statements, env)
+	testutil.Integer(t, evaluated[len(evaluated)-1], 1)
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"hello world"`, "hello world"},
+		{`"hello" + " " + "world"`, "hello world"},
+		{`let greet = fn(name) { return "hi " + name; }; greet("bob");`, "hi bob"},
+		{`"tab\there"`, "tab\there"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated[len(evaluated)-1].(*object.String)
+		if !ok {
+			t.Fatalf("object is not String. got=%T (%+v)", evaluated[len(evaluated)-1], evaluated[len(evaluated)-1])
+		}
+		if str.Value != tt.expected {
+			t.Errorf("String has wrong value. expected=%q, got=%q", tt.expected, str.Value)
+		}
+	}
+}
+
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"abc" < "abd"`, true},
+		{`"b" > "abc"`, true},
+		{`"b" <= "b"`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testutil.Boolean(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`"a" - "b"`, "unknown operator: STRING-STRING"},
+		{`"a" + 1`, "type mismatch: STRING+INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated[len(evaluated)-1].(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T", tt.input, evaluated[len(evaluated)-1])
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestFloatExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"-2.5", -2.5},
+		{"1e-9", 1e-9},
+		{"1.5 + 1.5", 3},
+		{"1 + 2.5", 3.5},
+		{"2.5 + 1", 3.5},
+		{"10 / 4.0", 2.5},
+		{"3 * 0.5 - 1", 0.5},
+		{"let half = fn(x) { return x / 2.0; }; half(5);", 2.5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testutil.Float(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+}
+
+func TestNumberComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1.5 < 2", true},
+		{"2 > 1.5", true},
+		{"1 == 1.0", true},
+		{"0.1 + 0.2 == 0.3", false},
+		{"2.5 >= 2.5", true},
+		{"3 != 3.0", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testutil.Boolean(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"3.0", "3.0\n"},
+		{"1 + 2.5", "3.5\n"},
+		{"1e21", "1e+21\n"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated[0].Inspect() != tt.expected {
+			t.Errorf("wrong inspect for %q, expected %q, got %q", tt.input, tt.expected, evaluated[0].Inspect())
+		}
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	evaluated := testEval("[1, 2 * 2, 3 + 3]")
+	result, ok := evaluated[0].(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated[0], evaluated[0])
+	}
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d", len(result.Elements))
+	}
+	testutil.Integer(t, result.Elements[0], 1)
+	testutil.Integer(t, result.Elements[1], 4)
+	testutil.Integer(t, result.Elements[2], 6)
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let xs = [1, 2, 3]; xs[0] + xs[1] + xs[2];", 6},
+		{"let xs = [[1, 2], [3, 4]]; xs[1][0];", 3},
+		{`"hello"[1]`, "e"},
+		{`"héllo"[1]`, "é"},
+		{"[1, 2, 3][3]", "index out of range: 3 with length 3"},
+		{"[1, 2, 3][-1]", "negative index: -1"},
+		{`"abc"[5]`, "index out of range: 5 with length 3"},
+		{`[1, 2]["a"]`, "index must be an INTEGER, got STRING"},
+		{"5[0]", "index operator not supported: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testutil.Object(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3, 4][1:3]", "[2, 3]\n"},
+		{"[1, 2, 3, 4][:2]", "[1, 2]\n"},
+		{"[1, 2, 3, 4][2:]", "[3, 4]\n"},
+		{"[1, 2, 3, 4][:]", "[1, 2, 3, 4]\n"},
+		{"[1, 2, 3][1:1]", "[]\n"},
+		{`"hello world"[0:5]`, "hello\n"},
+		{`"héllo"[1:3]`, "él\n"},
+		{`"abc"[1:]`, "bc\n"},
+		{`["a", "b", "c"][1:]`, `["b", "c"]` + "\n"},
+		{"[1, 2, 3][2:1]", "ERROR : slice bounds out of range [2:1] with length 3 at line 1, column 10\n"},
+		{"[1, 2, 3][0:4]", "ERROR : slice bounds out of range [0:4] with length 3 at line 1, column 10\n"},
+		{"[1, 2, 3][-1:]", "ERROR : slice bounds out of range [-1:3] with length 3 at line 1, column 10\n"},
+		{`[1, 2, 3]["a":]`, "ERROR : slice bounds must be INTEGER, got STRING at line 1, column 10\n"},
+		{"5[1:2]", "ERROR : slice operator not supported: INTEGER at line 1, column 2\n"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated[0].Inspect() != tt.expected {
+			t.Errorf("wrong result for %q, expected %q, got %q", tt.input, tt.expected, evaluated[0].Inspect())
+		}
+	}
+}
+
+func TestArrayConcatenation(t *testing.T) {
+	evaluated := testEval("let a = [1, 2]; let b = a + [3]; a + b;")
+	if evaluated[2].Inspect() != "[1, 2, 1, 2, 3]\n" {
+		t.Errorf("wrong result, got %q", evaluated[2].Inspect())
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	evaluated := testEval(input)
+	result, ok := evaluated[len(evaluated)-1].(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated[len(evaluated)-1], evaluated[len(evaluated)-1])
+	}
+
+	expected := map[object.HashKey]int{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		TRUE.HashKey():                             5,
+		FALSE.HashKey():                            6,
+	}
+
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	}
+
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+		}
+		testutil.Integer(t, pair.Value, expectedValue)
+	}
+
+	if result.Inspect() != `{"one": 1, "two": 2, "three": 3, 4: 4, true: 5, false: 6}`+"\n" {
+		t.Errorf("wrong inspect, got %q", result.Inspect())
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+		{`{"a": 1, "a": 2}["a"]`, 2},
+		{`{"foo": 5}[fn(x) { x }]`, "unusable as hash key: FUNCTION"},
+		{`{[1]: 5}`, "unusable as hash key: ARRAY"},
+		{`{1.5: 5}`, "unusable as hash key: FLOAT"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testutil.Object(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("héllo")`, 5},
+		{`len([1, 2, 3])`, 3},
+		{`len({"a": 1})`, 1},
+		{`len(1)`, "argument to len not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments to len: expected 1, got 2"},
+		{`type(1)`, "INTEGER"},
+		{`type("a")`, "STRING"},
+		{`type(len)`, "BUILTIN"},
+		{`type(fn() {})`, "FUNCTION"},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`first(1)`, "argument to first must be ARRAY, got INTEGER"},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, nil},
+		{`rest([])`, nil},
+		{`push(1, 1)`, "first argument to push must be ARRAY, got INTEGER"},
+		{`keys(1)`, "argument to keys must be HASH, got INTEGER"},
+		{`str(12)`, "12"},
+		{`str("a")`, "a"},
+		{`str(1.5) + "!"`, "1.5!"},
+		{`int("42")`, 42},
+		{`int(" -7 ")`, -7},
+		{`int(3.9)`, 3},
+		{`int(true)`, 1},
+		{`int("abc")`, `could not convert "abc" to an integer`},
+		{`int([1])`, "argument to int not supported, got ARRAY"},
+		{`bool(0)`, true},
+		{`bool("")`, true},
+		{`bool(false)`, false},
+		{`bool(first([]))`, false},
+		{`range(0, 5, 0)`, "range step must not be zero"},
+		{`range("a")`, "arguments to range must be INTEGER, got STRING"},
+		{`range()`, "wrong number of arguments to range: expected 1 to 3, got 0"},
+		{`let len = fn(x) { 42 }; len("a");`, 42},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testutil.Object(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+}
+
+func TestBuiltinCollections(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`rest([1, 2, 3])`, "[2, 3]\n"},
+		{`let a = [1]; let b = push(a, 2); a + b;`, "[1, 1, 2]\n"},
+		{`keys({"a": 1, 2: "b"})`, `["a", 2]` + "\n"},
+		{`values({"a": 1, 2: "b"})`, `[1, "b"]` + "\n"},
+		{`range(4)`, "[0, 1, 2, 3]\n"},
+		{`range(2, 5)`, "[2, 3, 4]\n"},
+		{`range(10, 0, -3)`, "[10, 7, 4, 1]\n"},
+		{`range(5, 2)`, "[]\n"},
+		{`range(9223372036854775800, 9223372036854775807, 5)`, "[9223372036854775800, 9223372036854775805]\n"},
+		{`range(-9223372036854775800, -9223372036854775807 - 1, -5)`, "[-9223372036854775800, -9223372036854775805]\n"},
+		{`str([1, "a"])`, `[1, "a"]` + "\n"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated[len(evaluated)-1].Inspect() != tt.expected {
+			t.Errorf("wrong result for %q, expected %q, got %q", tt.input, tt.expected, evaluated[len(evaluated)-1].Inspect())
+		}
+	}
+}
+
+func TestPrintStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`print("hello");`, "hello\n"},
+		{`print();`, "\n"},
+		{`print(1, "a", true, 2.5);`, "1 a true 2.5\n"},
+		{`print([1, "a"], {"k": "v"});`, `[1, "a"] {"k": "v"}` + "\n"},
+		{`let i = 0; while (i < 3) { print(i); i = i + 1; }`, "0\n1\n2\n"},
+		{`let f = fn(x) { print("in f", x); return x * 2; }; print(f(2));`, "in f 2\n4\n"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		eval := New()
+		eval.Output = &out
+
+		program := parser.New(lexer.New(tt.input)).GetStatements()
+		evaluated := eval.EvaluateProgram(program.Statements, object.NewEnvironment())
+		for _, obj := range evaluated {
+			if obj != nil {
+				t.Errorf("print returned a value for %q: %v", tt.input, obj.Inspect())
+			}
+		}
+
+		if out.String() != tt.expected {
+			t.Errorf("wrong output for %q, expected %q, got %q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestPrintErrors(t *testing.T) {
+	var out bytes.Buffer
+	eval := New()
+	eval.Output = &out
+
+	program := parser.New(lexer.New(`print(1, x);`)).GetStatements()
+	evaluated := eval.EvaluateProgram(program.Statements, object.NewEnvironment())
+
+	testutil.Object(t, evaluated[0], "identifier not found: x")
+	if out.Len() != 0 {
+		t.Errorf("nothing should have been printed, got %q", out.String())
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedLine int
+	}{
+		{"1 / 0;", 1},
+		{"let a = 5;\nlet b = a / (a - 5);", 2},
+		{"let f = fn(x) {\n\treturn 10 / x;\n};\nf(0);", 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated[len(evaluated)-1].(*object.Error)
+		if !ok {
+			t.Fatalf("no error object returned for %q. got=%T", tt.input, evaluated[len(evaluated)-1])
+		}
+		if errObj.Message != "division by zero" {
+			t.Errorf("wrong error message. got=%q", errObj.Message)
+		}
+		if errObj.Line != tt.expectedLine {
+			t.Errorf("wrong error line for %q. expected=%d, got=%d", tt.input, tt.expectedLine, errObj.Line)
+		}
+	}
+
+	testutil.Float(t, testEval("1 / 0.0")[0], math.Inf(1))
+}
+
+func TestInternalErrorRecovery(t *testing.T) {
+	// a malformed tree, the parser never builds a prefix expression without operand
+	statements := []ast.Statement{
+		&ast.ExpressionStatement{Expression: &ast.IntegerLiteral{Value: 5}},
+		&ast.ExpressionStatement{Expression: &ast.PrefixExpression{Operator: "-"}},
+		&ast.ExpressionStatement{Expression: &ast.IntegerLiteral{Value: 6}},
+	}
+
+	evaluated := EvaluateProgram(statements, object.NewEnvironment())
+	if len(evaluated) != 2 {
+		t.Fatalf("expected the program to stop after the failing statement, got %d results", len(evaluated))
+	}
+	testutil.Integer(t, evaluated[0], 5)
+	errObj, ok := evaluated[1].(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T", evaluated[1])
+	}
+	if !strings.HasPrefix(errObj.Message, "internal error: ") {
+		t.Errorf("expected an internal error, got %q", errObj.Message)
+	}
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"4611686018427387904 * 4", "18446744073709551616"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"(-9223372036854775807 - 1) / -1", "9223372036854775808"},
+		{"123456789012345678901234567890", "123456789012345678901234567890"},
+		{"123456789012345678901234567890 + 10", "123456789012345678901234567900"},
+		{"-123456789012345678901234567890 / 1000", "-123456789012345678901234567"},
+		{`int("123456789012345678901234567890")`, "123456789012345678901234567890"},
+		{"int(1e20)", "100000000000000000000"},
+		{`
+let fact = fn(n) {
+	if (n == 0) { return 1; }
+	return n * fact(n - 1);
+};
+fact(25);`, "15511210043330985984000000"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		result, ok := evaluated[len(evaluated)-1].(*object.Integer)
+		if !ok {
+			t.Errorf("object is not Integer for %q. got=%T (%+v)", tt.input, evaluated[len(evaluated)-1], evaluated[len(evaluated)-1])
+			continue
+		}
+		if result.Inspect() != tt.expected+"\n" {
+			t.Errorf("wrong value for %q. expected=%s, got=%s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestBigIntegerDemotion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"let x = 9223372036854775807 + 1; x - 1;", 9223372036854775807},
+		{"123456789012345678901234567890 / 1000000000000000000000", 123456789},
+		{"100000000000000000000 - 100000000000000000000", 0},
+		{"int(\"42\")", 42},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		result, ok := evaluated[len(evaluated)-1].(*object.Integer)
+		if !ok {
+			t.Errorf("object is not Integer for %q. got=%T", tt.input, evaluated[len(evaluated)-1])
+			continue
+		}
+		if result.Big != nil {
+			t.Errorf("expected %q to fit in an int, got a big integer", tt.input)
+		}
+		testutil.Integer(t, result, tt.expected)
+	}
+}
+
+func TestBigIntegerOperations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"100000000000000000000 > 99999999999999999999", true},
+		{"100000000000000000000 == 100000000000000000000", true},
+		{"100000000000000000000 != 100000000000000000000", false},
+		{"100000000000000000000 < 1", false},
+		{"-100000000000000000000 <= 1", true},
+		{`{100000000000000000000: "a"}[100000000000000000000]`, "a"},
+		{"[1][100000000000000000000]", "index out of range: 100000000000000000000 with length 1"},
+		{"[1][-100000000000000000000]", "negative index: -100000000000000000000"},
+		{"100000000000000000000 / 0", "division by zero"},
+		{"range(100000000000000000000)", "range bound too large: 100000000000000000000"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testutil.Object(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+
+	testutil.Float(t, testEval("100000000000000000000 * 1.5")[0], 1.5e20)
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		{"false && x", false},
+		{"true || x", true},
+		{"true && x", "identifier not found: x"},
+		{"1 && true", true},
+		{"false || 1", true},
+		{`"" && 0`, true},
+		{"[] || false", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testutil.Object(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+}
+
+func TestLogicalShortCircuit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"let calls = 0; let f = fn() { calls = calls + 1; return true; }; false && f(); calls;", 0},
+		{"let calls = 0; let f = fn() { calls = calls + 1; return true; }; true || f(); calls;", 0},
+		{"let calls = 0; let f = fn() { calls = calls + 1; return true; }; true && f(); calls;", 1},
+		{"let calls = 0; let f = fn() { calls = calls + 1; return false; }; f() || f(); calls;", 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testutil.Integer(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+}
+
+func testEval(input string) []object.Object {
+	return testEvalWith(New(), input)
+}
+
+func testEvalFile(e *Evaluator, file, input string) []object.Object {
+	program := parser.New(lexer.NewFile(file, input)).GetStatements()
+	return e.EvaluateProgram(program.Statements, object.NewEnvironment())
+}
+
+func testEvalWith(e *Evaluator, input string) []object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+
+	program := p.GetStatements()
+
+	env := object.NewEnvironment()
+
+	return e.EvaluateProgram(program.Statements, env)
+}
+
+func TestModuloExponentBitwise(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"(-2) ** 3", -8},
+		{"-2 ** 2", -4},
+		{"(-1) ** 1000000000001", -1},
+		{"5 ** 0", 1},
+		{"str(2 ** 100)", "1267650600228229401496703205376"},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"~5", -6},
+		{"~-1", 0},
+		{"1 << 4", 16},
+		{"-16 >> 2", -4},
+		{"1 >> 100", 0},
+		{"str(1 << 64)", "18446744073709551616"},
+		{"(1 << 64) >> 64", 1},
+		{"(1 << 64) % 10", 6},
+		{"str(~(1 << 64))", "-18446744073709551617"},
+		{"(1 << 64) & 1", 0},
+		{"1 + 2 * 3 % 4", 3},
+		{"7 % 0", "modulo by zero"},
+		{"(1 << 64) % 0", "modulo by zero"},
+		{"1 << -1", "negative shift count: -1"},
+		{"1 >> -1", "negative shift count: -1"},
+		{"2 ** 100000000", "integer too large"},
+		{"1 << 100000000", "integer too large"},
+		{"1.5 & 1", "unknown operator: FLOAT&FLOAT"},
+		{"~true", "unknown operator: ~BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testutil.Object(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+
+	testutil.Float(t, testEval("2 ** -1")[0], 0.5)
+	testutil.Float(t, testEval("7.5 % 2")[0], 1.5)
+	testutil.Float(t, testEval("2.0 ** 0.5")[0], math.Sqrt2)
+}
+
+func TestLenientTruthiness(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let r = 0; if (1) { r = 10; } else { r = 20; } r;", 10},
+		{"let r = 0; if (0) { r = 10; } else { r = 20; } r;", 10},
+		{`let r = 0; if ("") { r = 10; } else { r = 20; } r;`, 10},
+		{"let r = 0; if ([]) { r = 10; } else { r = 20; } r;", 10},
+		{"let r = 0; if ({}[1]) { r = 10; } else { r = 20; } r;", 20},
+		{"let r = 0; if (false) { r = 10; } else { r = 20; } r;", 20},
+		{"!5", false},
+		{"!!5", true},
+		{"!false", true},
+		{"!{}[1]", true},
+		{"let x = {}[1]; let n = 0; while (!x) { n = n + 1; if (n == 3) { x = 1; } } n;", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testutil.Object(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+}
+
+func TestStrictTruthiness(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let r = 0; if (true) { r = 10; } else { r = 20; } r;", 10},
+		{"let r = 0; if (1 > 2) { r = 10; } else { r = 20; } r;", 20},
+		{"!true", false},
+		{"true && false || true", true},
+		{"let r = 0; if (1) { r = 10; } r;", "condition must be BOOLEAN, got INTEGER"},
+		{`while ("a") { break; }`, "condition must be BOOLEAN, got STRING"},
+		{"!5", "operand of ! must be BOOLEAN, got INTEGER"},
+		{"1 && true", "operand of && must be BOOLEAN, got INTEGER"},
+		{"false || 1", "operand of || must be BOOLEAN, got INTEGER"},
+		{"false && 1", false},
+	}
+
+	for _, tt := range tests {
+		e := New()
+		e.Truthiness = Strict
+		evaluated := testEvalWith(e, tt.input)
+		testutil.Object(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"x;", 1, 1},
+		{"let a = 1;\nlet b = a + true;", 2, 11},
+		{"let a = [1];\n  a[5];", 2, 4},
+		{"let f = fn() {\n\tlen(1, 2);\n};\nf();", 2, 5},
+		{"let f = fn(x) {\n  x / 0\n};\nf(1);", 2, 5},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewFile("test.qfa", tt.input)
+		program := parser.New(l).GetStatements()
+		evaluated := EvaluateProgram(program.Statements, object.NewEnvironment())
+
+		errObj, ok := evaluated[len(evaluated)-1].(*object.Error)
+		if !ok {
+			t.Fatalf("no error object returned for %q. got=%T", tt.input, evaluated[len(evaluated)-1])
+		}
+		if errObj.File != "test.qfa" || errObj.Line != tt.expectedLine || errObj.Column != tt.expectedColumn {
+			t.Errorf("wrong position for %q. expected=test.qfa:%d:%d, got=%s:%d:%d", tt.input,
+				tt.expectedLine, tt.expectedColumn, errObj.File, errObj.Line, errObj.Column)
+		}
+	}
+}
+
+func TestErrorStack(t *testing.T) {
+	input := `let inner = fn(x) {
+  return x + y;
+};
+let outer = fn() {
+  return inner(1) + 1;
+};
+let anonymous = [fn() { outer() }];
+anonymous[0]();`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated[len(evaluated)-1].(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T", evaluated[len(evaluated)-1])
+	}
+
+	expected := `ERROR : identifier not found: y at line 2, column 14
+  in inner called at line 5, column 15
+  in outer called at line 7, column 30
+  in anonymous function called at line 8, column 13
+`
+	if errObj.Inspect() != expected {
+		t.Errorf("wrong traceback, expected:\n%s\ngot:\n%s", expected, errObj.Inspect())
+	}
+
+	// the stack is back to empty once the error left the functions
+	e := New()
+	testEvalWith(e, input)
+	evaluated = testEvalWith(e, "z;")
+	if errObj := evaluated[len(evaluated)-1].(*object.Error); len(errObj.Stack) != 0 {
+		t.Errorf("stack not emptied after an error. got=%v", errObj.Stack)
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let r = 0; try { r = 1; } catch (e) { r = 2; } r;`, 1},
+		{`let r = ""; try { throw "oops"; } catch (e) { r = e["message"]; } r;`, "oops"},
+		{`let r = ""; try { x; } catch (e) { r = e["message"]; } r;`, "identifier not found: x"},
+		{`let r = 0; try { 1 / 0; r = 1; } catch (e) { r = 2; } r;`, 2},
+		{`let r = ""; try { throw 42; } catch (e) { r = e["message"]; } r;`, "42"},
+		{`let f = fn() { throw "inner"; }; let r = ""; try { f(); } catch (e) { r = e["message"]; } r;`, "inner"},
+		{`let r = 0; try { throw "a"; } catch (e) { r = 1; } finally { r = r + 10; } r;`, 11},
+		{`let r = 0; try { r = 1; } finally { r = r + 10; } r;`, 11},
+		{`let f = fn() { try { return 1; } finally { return 2; } }; f();`, 2},
+		{`let f = fn() { try { return 1; } catch (e) { return 2; } }; f();`, 1},
+		{`let r = 0; let f = fn() { try { return 1; } finally { r = 5; } }; f() + r;`, 6},
+		{`let i = 0; while (true) { try { i = i + 1; if (i == 3) { break; } } finally { } } i;`, 3},
+		{`let r = ""; try { try { throw "a"; } catch (e) { throw e; } } catch (e) { r = e["message"]; } r;`, "a"},
+		{`let r = ""; try { try { throw "a"; } finally { r = "f"; } } catch (e) { r = r + e["message"]; } r;`, "fa"},
+		{`try { throw "a"; } catch (e) { throw "b"; }`, "b"},
+		{`try { 1; } finally { throw "f"; }`, "f"},
+		{`let e = 1; try { throw "a"; } catch (e) { } e;`, 1},
+		{`throw "uncaught"; 5;`, "uncaught"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		result := evaluated[len(evaluated)-1]
+		if signal := blockSignal(result); signal != nil {
+			result = signal
+		}
+		testutil.Object(t, result, tt.expected)
+	}
+}
+
+func TestCaughtErrorValue(t *testing.T) {
+	input := `let f = fn() {
+  return missing;
+};
+let caught = 0;
+try {
+  f();
+} catch (e) {
+  caught = e;
+}
+caught;`
+
+	evaluated := testEval(input)
+	expected := `{"message": "identifier not found: missing", "file": "", "line": 2, "column": 10, ` +
+		`"stack": [{"function": "f", "file": "", "line": 6, "column": 4}]}` + "\n"
+	if evaluated[len(evaluated)-1].Inspect() != expected {
+		t.Errorf("wrong caught error, expected %q, got %q", expected, evaluated[len(evaluated)-1].Inspect())
+	}
+}
+
+func TestCallDepthLimit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn(n) { if (n == 0) { return 0; } return 1 + f(n - 1); }; f(5000);", 5000},
+		{"let f = fn(n) { if (n == 0) { return 0; } return 1 + f(n - 1); }; f(20000);", "stack overflow: more than 10000 nested calls"},
+		{"let f = fn() { f() + 1 }; f();", "stack overflow: more than 10000 nested calls"},
+		{`let f = fn() { f() + 1 }; let r = ""; try { f(); } catch (e) { r = e["message"]; } r;`, "stack overflow: more than 10000 nested calls"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testutil.Object(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+
+	e := New()
+	e.MaxCallDepth = 10
+	evaluated := testEvalWith(e, "let f = fn(n) { if (n == 0) { return 0; } return 1 + f(n - 1); }; f(10);")
+	testutil.Object(t, evaluated[len(evaluated)-1], "stack overflow: more than 10 nested calls")
+	evaluated = testEvalWith(e, "let f = fn(n) { if (n == 0) { return 0; } return 1 + f(n - 1); }; f(9);")
+	testutil.Object(t, evaluated[len(evaluated)-1], 9)
+
+	// the traceback of a deep stack only shows both ends
+	e.MaxCallDepth = 30
+	evaluated = testEvalWith(e, "let f = fn() { f() + 1 }; f();")
+	lines := strings.Split(strings.TrimSuffix(evaluated[len(evaluated)-1].Inspect(), "\n"), "\n")
+	if len(lines) != 22 || lines[11] != "  ... 10 more calls" {
+		t.Errorf("wrong traceback for a deep stack, got %q", lines)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let sum = fn(n, acc) { if (n == 0) { return acc; } return sum(n - 1, acc + n); }; sum(100000, 0);", 5000050000},
+		{`
+let even = fn(n) { if (n == 0) { return true; } return odd(n - 1); };
+let odd = fn(n) { if (n == 0) { return false; } return even(n - 1); };
+even(100001);`, false},
+		{"let f = fn(n) { if (n == 0) { return len([1, 2]); } return f(n - 1); }; f(50000);", 2},
+		{"let f = fn(n) { if (n == 0) { return 0; } return f(n - 1, 1); }; f(3);", "wrong number of arguments: expected 1, got 2"},
+		{"let f = fn(n) { if (n == 0) { return 0; } return n(1); }; f(3);", "not a function: INTEGER"},
+		// a call inside a try block needs its frame, the error would escape the try otherwise
+		{`
+let f = fn(n) {
+  if (n == 0) { throw "done"; }
+  try { return f(n - 1); } catch (e) { return n; }
+};
+f(3);`, 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testutil.Object(t, evaluated[len(evaluated)-1], tt.expected)
+	}
+
+	// a function called from a try block gets its tail calls back
+	evaluated := testEval(`
+let count = fn(n) { if (n == 0) { return "ok"; } return count(n - 1); };
+let r = "";
+try { r = count(50000); } catch (e) { r = e["message"]; }
+r;`)
+	testutil.Object(t, evaluated[len(evaluated)-1], "ok")
+}
+
+func TestExecutionLimits(t *testing.T) {
+	tests := []struct {
+		limits   Limits
+		input    string
+		expected string
+	}{
+		{Limits{MaxSteps: 1000}, "while (true) { }", "execution limit exceeded: more than 1000 steps"},
+		{Limits{MaxSteps: 1000}, "let f = fn(n) { return f(n + 1); }; f(0);", "execution limit exceeded: more than 1000 steps"},
+		{Limits{MaxDuration: 10 * time.Millisecond}, "while (true) { }", "execution limit exceeded: ran for more than 10ms"},
+		{Limits{MaxAllocations: 100}, "let a = []; while (true) { a = push(a, 1); }", "execution limit exceeded: more than 100 objects allocated"},
+		{Limits{MaxAllocations: 100}, "range(1000);", "execution limit exceeded: more than 100 objects allocated"},
+		{Limits{MaxAllocations: 1000}, "range(200000000);", "execution limit exceeded: more than 1000 objects allocated"},
+		{Limits{MaxAllocations: 1000}, "array(0..=9223372036854775806);", "execution limit exceeded: more than 1000 objects allocated"},
+		{Limits{MaxDuration: 10 * time.Millisecond}, "array(0..50000000);", "execution limit exceeded: ran for more than 10ms"},
+		{Limits{MaxSteps: 1000}, `let r = 0; try { while (true) { } } catch (e) { r = 1; } r;`, "execution limit exceeded: more than 1000 steps"},
+		{Limits{MaxSteps: 1000}, `let r = 0; try { while (true) { } } finally { r = 1; } r;`, "execution limit exceeded: more than 1000 steps"},
+	}
+
+	for _, tt := range tests {
+		e := New()
+		e.Limits = tt.limits
+		evaluated := testEvalWith(e, tt.input)
+		result := evaluated[len(evaluated)-1]
+		if signal := blockSignal(result); signal != nil {
+			result = signal
+		}
+		errObj, ok := result.(*object.Error)
+		if !ok {
+			t.Fatalf("no error object returned for %q. got=%T", tt.input, result)
+		}
+		if errObj.Message != tt.expected || !errObj.Fatal {
+			t.Errorf("wrong error for %q. expected=%q, got=%q (fatal=%v)", tt.input, tt.expected, errObj.Message, errObj.Fatal)
+		}
+	}
+
+	// the limits apply to each program, not to the lifetime of the evaluator
+	e := New()
+	e.Limits = Limits{MaxSteps: 1000, MaxAllocations: 100}
+	for i := 0; i < 5; i++ {
+		evaluated := testEvalWith(e, "let i = 0; while (i < 10) { i = i + 1; } i;")
+		testutil.Object(t, evaluated[len(evaluated)-1], 10)
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	program := parser.New(lexer.New("let i = 0; while (true) { i = i + 1; }")).GetStatements()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	evaluated := New().EvaluateProgramContext(ctx, program.Statements, object.NewEnvironment())
+	testutil.Object(t, evaluated[len(evaluated)-1], "execution limit exceeded: context deadline exceeded")
 
-	return EvaluateProgram(program.Statements, env)
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	evaluated = New().EvaluateProgramContext(ctx, program.Statements, object.NewEnvironment())
+	testutil.Object(t, evaluated[len(evaluated)-1], "execution limit exceeded: context canceled")
 }
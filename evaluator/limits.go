@@ -0,0 +1,24 @@
+package evaluator
+
+import (
+	"context"
+
+	"github.com/tysufa/qfa/ast"
+	"github.com/tysufa/qfa/object"
+	"github.com/tysufa/qfa/resolver"
+)
+
+// Limits bounds the resources a program can use, see object.Limits
+type Limits = object.Limits
+
+// EvaluateProgramContext evaluates statements like EvaluateProgram, stopping as
+// soon as ctx is done or one of e.Limits is exceeded
+func (e *Evaluator) EvaluateProgramContext(ctx context.Context, statements []ast.Statement, env *object.Environment) []object.Object {
+	e.usage.Start(ctx, e.Limits)
+	defer e.usage.Stop()
+
+	if err := resolver.Resolve(statements, env); err != nil {
+		return []object.Object{err}
+	}
+	return e.evaluateStatements(statements, env)
+}
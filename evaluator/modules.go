@@ -0,0 +1,72 @@
+package evaluator
+
+import (
+	"github.com/tysufa/qfa/ast"
+	"github.com/tysufa/qfa/module"
+	"github.com/tysufa/qfa/object"
+	"github.com/tysufa/qfa/resolver"
+)
+
+// importModule gives the module imported by node: a standard module, or the
+// one of a file. Every file is evaluated once by an evaluator, the later
+// imports share its module
+func (e *Evaluator) importModule(node *ast.ImportStatement) object.Object {
+	if mod := object.GetStandardModule(node.Path); mod != nil {
+		return mod
+	}
+	path, err := module.Find(node.Path, node.Token.File)
+	if err != nil {
+		return newErr("%v", err)
+	}
+	if mod, ok := e.modules[path]; ok {
+		return mod
+	}
+	if len(e.loading) == 0 {
+		e.importer = node.Token.File
+	}
+	if cycle := module.Cycle(e.importer, e.loading, path, node.Path); cycle != "" {
+		return newErr("import cycle: %s", cycle)
+	}
+
+	program, err := module.Load(path)
+	if err != nil {
+		return newErr("error in module %s: %v", node.Path, err)
+	}
+	env := object.NewEnvironment()
+	if err := resolver.Resolve(program.Statements, env); err != nil {
+		return err
+	}
+	mod := &object.Module{Name: node.Path, Path: path, Get: env.Get}
+
+	// the file runs on its own rather than as part of the function importing it
+	frames, tryDepth := e.frames, e.tryDepth
+	e.frames, e.tryDepth = nil, 0
+	e.loading = append(e.loading, mod)
+	results := e.evaluateStatements(program.Statements, env)
+	e.loading = e.loading[:len(e.loading)-1]
+	e.frames, e.tryDepth = frames, tryDepth
+
+	if len(results) > 0 {
+		last := results[len(results)-1]
+		if signal := blockSignal(last); signal != nil {
+			last = signal
+		}
+		if isError(last) {
+			return last
+		}
+	}
+
+	if e.modules == nil {
+		e.modules = make(map[string]*object.Module)
+	}
+	e.modules[path] = mod
+	return mod
+}
+
+func (e *Evaluator) evaluateMemberExpression(node *ast.MemberExpression, env *object.Environment) object.Object {
+	left := e.evaluate(node.Left, env)
+	if interrupts(left) {
+		return left
+	}
+	return object.Member(left, node.Member.Value)
+}
@@ -1,30 +1,47 @@
 package lexer
 
 import (
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
 	"github.com/tysufa/qfa/token"
 )
 
 type Lexer struct {
-	curChar  byte
-	peekChar byte
-	input    string
-	pos      int
-	line     int
+	curChar   byte
+	peekChar  byte
+	input     string
+	pos       int
+	offset    int // position of curChar in input
+	line      int
+	lineStart int // position in input of the first character of the line
+	file      string
+	Errors    []string
 }
 
 func New(input string) Lexer {
-	l := Lexer{input: input, pos: -1, line: 1}
+	l := Lexer{input: input, pos: -1, offset: -2, line: 1}
 	l.nextChar()
 	l.nextChar()
 
 	return l
 }
 
+// NewFile creates a lexer for the content of a source file, every token is
+// tagged with the name of the file
+func NewFile(file, input string) Lexer {
+	l := New(input)
+	l.file = file
+	return l
+}
+
 func (l *Lexer) GetToken() token.Token {
-	// TODO: check for strings and floating numbers
 	var tok token.Token
 
 	l.skipSpaces()
+	tok.File = l.file
+	tok.Column = l.column()
 	switch l.curChar {
 	case 0:
 		tok.Type = token.EOF
@@ -34,7 +51,7 @@ func (l *Lexer) GetToken() token.Token {
 		tok.Type = token.NL
 		tok.Value = "\n"
 		tok.Line = l.line
-		l.line++
+		l.newLine()
 	case ';':
 		tok.Type = token.SEMICOLON
 		tok.Value = string(l.curChar)
@@ -49,6 +66,11 @@ func (l *Lexer) GetToken() token.Token {
 			tok.Value = "<="
 			tok.Line = l.line
 			l.nextChar()
+		} else if l.peekChar == '<' {
+			tok.Type = token.LSHIFT
+			tok.Value = "<<"
+			tok.Line = l.line
+			l.nextChar()
 		} else {
 			tok.Type = token.LT
 			tok.Value = string(l.curChar)
@@ -60,6 +82,11 @@ func (l *Lexer) GetToken() token.Token {
 			tok.Value = ">="
 			tok.Line = l.line
 			l.nextChar()
+		} else if l.peekChar == '>' {
+			tok.Type = token.RSHIFT
+			tok.Value = ">>"
+			tok.Line = l.line
+			l.nextChar()
 		} else {
 			tok.Type = token.GT
 			tok.Value = string(l.curChar)
@@ -76,12 +103,53 @@ func (l *Lexer) GetToken() token.Token {
 			tok.Value = string(l.curChar)
 			tok.Line = l.line
 		}
+	case '&':
+		if l.peekChar == '&' {
+			tok.Type = token.AND
+			tok.Value = "&&"
+			tok.Line = l.line
+			l.nextChar()
+		} else {
+			tok.Type = token.BIT_AND
+			tok.Value = string(l.curChar)
+			tok.Line = l.line
+		}
+	case '|':
+		if l.peekChar == '|' {
+			tok.Type = token.OR
+			tok.Value = "||"
+			tok.Line = l.line
+			l.nextChar()
+		} else {
+			tok.Type = token.BIT_OR
+			tok.Value = string(l.curChar)
+			tok.Line = l.line
+		}
 	case '/':
 		tok.Type = token.SLASH
 		tok.Value = string(l.curChar)
 		tok.Line = l.line
 	case '*':
-		tok.Type = token.STAR
+		if l.peekChar == '*' {
+			tok.Type = token.POWER
+			tok.Value = "**"
+			tok.Line = l.line
+			l.nextChar()
+		} else {
+			tok.Type = token.STAR
+			tok.Value = string(l.curChar)
+			tok.Line = l.line
+		}
+	case '%':
+		tok.Type = token.PERCENT
+		tok.Value = string(l.curChar)
+		tok.Line = l.line
+	case '^':
+		tok.Type = token.BIT_XOR
+		tok.Value = string(l.curChar)
+		tok.Line = l.line
+	case '~':
+		tok.Type = token.BIT_NOT
 		tok.Value = string(l.curChar)
 		tok.Line = l.line
 	case '-':
@@ -108,6 +176,39 @@ func (l *Lexer) GetToken() token.Token {
 		tok.Type = token.RBR
 		tok.Value = string(l.curChar)
 		tok.Line = l.line
+	case '[':
+		tok.Type = token.LBRACKET
+		tok.Value = string(l.curChar)
+		tok.Line = l.line
+	case ']':
+		tok.Type = token.RBRACKET
+		tok.Value = string(l.curChar)
+		tok.Line = l.line
+	case ':':
+		tok.Type = token.COLON
+		tok.Value = string(l.curChar)
+		tok.Line = l.line
+	case '.':
+		if l.peekChar == '.' && l.peekAt(1) == '=' {
+			tok.Type = token.DOTDOTEQ
+			tok.Value = "..="
+			tok.Line = l.line
+			l.nextChar()
+			l.nextChar()
+		} else if l.peekChar == '.' {
+			tok.Type = token.DOTDOT
+			tok.Value = ".."
+			tok.Line = l.line
+			l.nextChar()
+		} else {
+			tok.Type = token.DOT
+			tok.Value = string(l.curChar)
+			tok.Line = l.line
+		}
+	case '"':
+		tok.Type = token.STRING
+		tok.Line = l.line
+		tok.Value = l.getString()
 	case '=':
 		if l.peekChar == '=' {
 			tok.Type = token.EQEQ
@@ -130,8 +231,8 @@ func (l *Lexer) GetToken() token.Token {
 			tok.Value = literal
 			tok.Line = l.line
 		} else if isNumber(l.curChar) {
-			nb := l.getInt()
-			tok.Type = token.INT
+			nb, tokType := l.getNumber()
+			tok.Type = tokType
 			tok.Value = nb
 			tok.Line = l.line
 		} else {
@@ -145,6 +246,37 @@ func (l *Lexer) GetToken() token.Token {
 	return tok
 }
 
+// getNumber reads an integer or a floating point number such as 3.14, 2e10 or 1.5E-9
+func (l *Lexer) getNumber() (string, token.TokenType) {
+	var tokType token.TokenType = token.INT
+	res := l.getInt()
+
+	// a dot is only part of the number if a digit follows it
+	if l.peekChar == '.' && isNumber(l.peekAt(1)) {
+		l.nextChar()
+		l.nextChar()
+		res += "." + l.getInt()
+		tokType = token.FLOAT
+	}
+
+	if l.peekChar == 'e' || l.peekChar == 'E' {
+		sign := l.peekAt(1) == '+' || l.peekAt(1) == '-'
+		if isNumber(l.peekAt(1)) || (sign && isNumber(l.peekAt(2))) {
+			l.nextChar()
+			res += string(l.curChar)
+			if sign {
+				l.nextChar()
+				res += string(l.curChar)
+			}
+			l.nextChar()
+			res += l.getInt()
+			tokType = token.FLOAT
+		}
+	}
+
+	return res, tokType
+}
+
 func (l *Lexer) getInt() string {
 	res := ""
 	for isNumber(l.peekChar) {
@@ -156,6 +288,73 @@ func (l *Lexer) getInt() string {
 	return res
 }
 
+// getString reads a double quoted string starting at the current character and
+// returns its content with the escape sequences decoded
+func (l *Lexer) getString() string {
+	var res []byte
+	startLine := l.line
+
+	for {
+		l.nextChar()
+		switch l.curChar {
+		case '"':
+			return string(res)
+		case 0:
+			l.Errors = append(l.Errors, fmt.Sprintf("unterminated string starting at line %v", startLine))
+			return string(res)
+		case '\n':
+			l.newLine()
+			res = append(res, l.curChar)
+		case '\\':
+			l.nextChar()
+			res = l.appendEscape(res)
+		default:
+			res = append(res, l.curChar)
+		}
+	}
+}
+
+func (l *Lexer) appendEscape(res []byte) []byte {
+	switch l.curChar {
+	case 'n':
+		return append(res, '\n')
+	case 't':
+		return append(res, '\t')
+	case '"':
+		return append(res, '"')
+	case '\\':
+		return append(res, '\\')
+	case 'u':
+		if l.peekChar != '{' {
+			l.Errors = append(l.Errors, fmt.Sprintf("expected '{' after \\u at line %v", l.line))
+			return res
+		}
+		l.nextChar()
+		hex := ""
+		for l.peekChar != '}' && l.peekChar != '"' && l.peekChar != 0 {
+			l.nextChar()
+			hex += string(l.curChar)
+		}
+		if l.peekChar != '}' {
+			l.Errors = append(l.Errors, fmt.Sprintf("unterminated \\u{...} escape at line %v", l.line))
+			return res
+		}
+		l.nextChar()
+
+		code, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			l.Errors = append(l.Errors, fmt.Sprintf("invalid unicode escape \\u{%v} at line %v", hex, l.line))
+			return res
+		}
+		return utf8.AppendRune(res, rune(code))
+	case 0:
+		return res
+	default:
+		l.Errors = append(l.Errors, fmt.Sprintf("unknown escape sequence \\%c at line %v", l.curChar, l.line))
+		return append(res, l.curChar)
+	}
+}
+
 func (l *Lexer) getWord() string {
 	res := ""
 	for isLetter(l.peekChar) || isNumber(l.peekChar) {
@@ -181,7 +380,23 @@ func (l *Lexer) skipSpaces() {
 	}
 }
 
+// column returns the column of curChar
+func (l *Lexer) column() int {
+	end := l.offset
+	if end > len(l.input) {
+		end = len(l.input)
+	}
+	return utf8.RuneCountInString(l.input[l.lineStart:end]) + 1
+}
+
+// newLine is called on the line feed at curChar
+func (l *Lexer) newLine() {
+	l.line++
+	l.lineStart = l.offset + 1
+}
+
 func (l *Lexer) nextChar() {
+	l.offset++
 	l.curChar = l.peekChar
 	if l.pos+1 < len(l.input) {
 		l.pos++
@@ -191,6 +406,14 @@ func (l *Lexer) nextChar() {
 	}
 }
 
+// peekAt returns the character n positions after peekChar
+func (l *Lexer) peekAt(n int) byte {
+	if l.peekChar == 0 || l.pos+n >= len(l.input) {
+		return 0
+	}
+	return l.input[l.pos+n]
+}
+
 func (l *Lexer) getCurChar() byte {
 	return l.input[l.pos]
 }
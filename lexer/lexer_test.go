@@ -76,3 +76,329 @@ func TestNextChar(t *testing.T) {
 		l.nextChar()
 	}
 }
+
+func TestGetString(t *testing.T) {
+	input := `"foo" "bar baz";
+"a\n\tb" "say \"hi\"" "back\\slash" "\u{48}\u{e9}\u{1F600}"
+"multi
+line" x`
+
+	l := New(input)
+
+	tests := []struct {
+		expectedValue string
+		expectedType  token.TokenType
+		expectedLine  int
+	}{
+		{"foo", token.STRING, 1},
+		{"bar baz", token.STRING, 1},
+		{";", token.SEMICOLON, 1},
+		{"\n", token.NL, 1},
+		{"a\n\tb", token.STRING, 2},
+		{`say "hi"`, token.STRING, 2},
+		{`back\slash`, token.STRING, 2},
+		{"Hé😀", token.STRING, 2},
+		{"\n", token.NL, 2},
+		{"multi\nline", token.STRING, 3},
+		{"x", token.IDENT, 4},
+		{"", token.EOF, 4},
+	}
+
+	for _, tt := range tests {
+		tok := l.GetToken()
+		if tt.expectedType != tok.Type {
+			t.Fatalf("wrong token type, expected '%s', got '%s' instead", tt.expectedType, tok.Type)
+		}
+		if tt.expectedValue != tok.Value {
+			t.Fatalf("wrong token value, expected %q, got %q instead", tt.expectedValue, tok.Value)
+		}
+		if tt.expectedLine != tok.Line {
+			t.Fatalf("wrong token line, expected %v, got %v instead", tt.expectedLine, tok.Line)
+		}
+	}
+
+	if len(l.Errors) != 0 {
+		t.Fatalf("unexpected lexer errors: %v", l.Errors)
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"let a = 1;\nlet s = \"abc;", "unterminated string starting at line 2"},
+		{`"\q"`, `unknown escape sequence \q at line 1`},
+		{`"\u{110000}"`, `invalid unicode escape \u{110000} at line 1`},
+		{`"\u{41"`, `unterminated \u{...} escape at line 1`},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for tok := l.GetToken(); tok.Type != token.EOF; tok = l.GetToken() {
+		}
+
+		if len(l.Errors) == 0 {
+			t.Fatalf("expected error %q for %q, got none", tt.expectedError, tt.input)
+		}
+		if l.Errors[0] != tt.expectedError {
+			t.Fatalf("wrong error, expected %q, got %q instead", tt.expectedError, l.Errors[0])
+		}
+	}
+}
+
+func TestGetNumber(t *testing.T) {
+	input := `42 3.14 0.5 1e-9 2E10 6.02e+23 7e 1.foo 5.`
+
+	l := New(input)
+
+	tests := []struct {
+		expectedValue string
+		expectedType  token.TokenType
+	}{
+		{"42", token.INT},
+		{"3.14", token.FLOAT},
+		{"0.5", token.FLOAT},
+		{"1e-9", token.FLOAT},
+		{"2E10", token.FLOAT},
+		{"6.02e+23", token.FLOAT},
+		{"7", token.INT},
+		{"e", token.IDENT},
+		{"1", token.INT},
+		{".", token.DOT},
+		{"foo", token.IDENT},
+		{"5", token.INT},
+		{".", token.DOT},
+		{"", token.EOF},
+	}
+
+	for _, tt := range tests {
+		tok := l.GetToken()
+		if tt.expectedType != tok.Type {
+			t.Fatalf("wrong token type for %q, expected '%s', got '%s' instead", tt.expectedValue, tt.expectedType, tok.Type)
+		}
+		if tt.expectedValue != tok.Value {
+			t.Fatalf("wrong token value, expected %s, got %s instead", tt.expectedValue, tok.Value)
+		}
+	}
+}
+
+func TestGetBrackets(t *testing.T) {
+	input := `[1, 2][0:1]`
+
+	l := New(input)
+
+	tests := []struct {
+		expectedValue string
+		expectedType  token.TokenType
+	}{
+		{"[", token.LBRACKET},
+		{"1", token.INT},
+		{",", token.COMMA},
+		{"2", token.INT},
+		{"]", token.RBRACKET},
+		{"[", token.LBRACKET},
+		{"0", token.INT},
+		{":", token.COLON},
+		{"1", token.INT},
+		{"]", token.RBRACKET},
+		{"", token.EOF},
+	}
+
+	for _, tt := range tests {
+		tok := l.GetToken()
+		if tt.expectedType != tok.Type {
+			t.Fatalf("wrong token type, expected '%s', got '%s' instead", tt.expectedType, tok.Type)
+		}
+		if tt.expectedValue != tok.Value {
+			t.Fatalf("wrong token value, expected %s, got %s instead", tt.expectedValue, tok.Value)
+		}
+	}
+}
+
+func TestGetImport(t *testing.T) {
+	input := `import "lib.qfa" as lib; lib.x`
+
+	l := New(input)
+
+	tests := []struct {
+		expectedValue string
+		expectedType  token.TokenType
+	}{
+		{"import", token.IMPORT},
+		{"lib.qfa", token.STRING},
+		{"as", token.AS},
+		{"lib", token.IDENT},
+		{";", token.SEMICOLON},
+		{"lib", token.IDENT},
+		{".", token.DOT},
+		{"x", token.IDENT},
+		{"", token.EOF},
+	}
+
+	for _, tt := range tests {
+		tok := l.GetToken()
+		if tt.expectedType != tok.Type {
+			t.Fatalf("wrong token type, expected '%s', got '%s' instead", tt.expectedType, tok.Type)
+		}
+		if tt.expectedValue != tok.Value {
+			t.Fatalf("wrong token value, expected %s, got %s instead", tt.expectedValue, tok.Value)
+		}
+	}
+}
+
+func TestGetLogicalOperators(t *testing.T) {
+	input := `a && b || !c & d | e`
+
+	l := New(input)
+
+	tests := []struct {
+		expectedValue string
+		expectedType  token.TokenType
+	}{
+		{"a", token.IDENT},
+		{"&&", token.AND},
+		{"b", token.IDENT},
+		{"||", token.OR},
+		{"!", token.BANG},
+		{"c", token.IDENT},
+		{"&", token.BIT_AND},
+		{"d", token.IDENT},
+		{"|", token.BIT_OR},
+		{"e", token.IDENT},
+		{"", token.EOF},
+	}
+
+	for _, tt := range tests {
+		tok := l.GetToken()
+		if tt.expectedType != tok.Type {
+			t.Fatalf("wrong token type, expected '%s', got '%s' instead", tt.expectedType, tok.Type)
+		}
+		if tt.expectedValue != tok.Value {
+			t.Fatalf("wrong token value, expected %s, got %s instead", tt.expectedValue, tok.Value)
+		}
+	}
+}
+
+func TestGetArithmeticOperators(t *testing.T) {
+	input := `a % b ** c * ~d ^ e << f >> g < h`
+
+	l := New(input)
+
+	tests := []struct {
+		expectedValue string
+		expectedType  token.TokenType
+	}{
+		{"a", token.IDENT},
+		{"%", token.PERCENT},
+		{"b", token.IDENT},
+		{"**", token.POWER},
+		{"c", token.IDENT},
+		{"*", token.STAR},
+		{"~", token.BIT_NOT},
+		{"d", token.IDENT},
+		{"^", token.BIT_XOR},
+		{"e", token.IDENT},
+		{"<<", token.LSHIFT},
+		{"f", token.IDENT},
+		{">>", token.RSHIFT},
+		{"g", token.IDENT},
+		{"<", token.LT},
+		{"h", token.IDENT},
+		{"", token.EOF},
+	}
+
+	for _, tt := range tests {
+		tok := l.GetToken()
+		if tt.expectedType != tok.Type {
+			t.Fatalf("wrong token type, expected '%s', got '%s' instead", tt.expectedType, tok.Type)
+		}
+		if tt.expectedValue != tok.Value {
+			t.Fatalf("wrong token value, expected %s, got %s instead", tt.expectedValue, tok.Value)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 1;\n  x + \"é\\n\" ;\n\"a\nb\" y"
+
+	l := NewFile("main.qfa", input)
+
+	tests := []struct {
+		expectedValue  string
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"1", 1, 9},
+		{";", 1, 10},
+		{"\n", 1, 11},
+		{"x", 2, 3},
+		{"+", 2, 5},
+		{"é\n", 2, 7},
+		{";", 2, 13},
+		{"\n", 2, 14},
+		{"a\nb", 3, 1},
+		{"y", 4, 4},
+		{"", 4, 5},
+	}
+
+	for _, tt := range tests {
+		tok := l.GetToken()
+		if tt.expectedValue != tok.Value {
+			t.Fatalf("wrong token value, expected %q, got %q instead", tt.expectedValue, tok.Value)
+		}
+		if tt.expectedLine != tok.Line || tt.expectedColumn != tok.Column {
+			t.Fatalf("wrong position for %q, expected %d:%d, got %d:%d instead", tok.Value, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+		if tok.File != "main.qfa" {
+			t.Fatalf("wrong file for %q, expected main.qfa, got %q instead", tok.Value, tok.File)
+		}
+	}
+}
+
+func TestGetRange(t *testing.T) {
+	input := `for (i in 1..n) {} 0..=10 step 2; 1.5..x.y`
+
+	l := New(input)
+
+	tests := []struct {
+		expectedValue string
+		expectedType  token.TokenType
+	}{
+		{"for", token.FOR},
+		{"(", token.LPAR},
+		{"i", token.IDENT},
+		{"in", token.IN},
+		{"1", token.INT},
+		{"..", token.DOTDOT},
+		{"n", token.IDENT},
+		{")", token.RPAR},
+		{"{", token.LBR},
+		{"}", token.RBR},
+		{"0", token.INT},
+		{"..=", token.DOTDOTEQ},
+		{"10", token.INT},
+		{"step", token.IDENT},
+		{"2", token.INT},
+		{";", token.SEMICOLON},
+		{"1.5", token.FLOAT},
+		{"..", token.DOTDOT},
+		{"x", token.IDENT},
+		{".", token.DOT},
+		{"y", token.IDENT},
+		{"", token.EOF},
+	}
+
+	for _, tt := range tests {
+		tok := l.GetToken()
+		if tt.expectedType != tok.Type {
+			t.Fatalf("wrong token type, expected '%s', got '%s' instead", tt.expectedType, tok.Type)
+		}
+		if tt.expectedValue != tok.Value {
+			t.Fatalf("wrong token value, expected %s, got %s instead", tt.expectedValue, tok.Value)
+		}
+	}
+}
@@ -1,9 +1,73 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tysufa/qfa/compiler"
+	"github.com/tysufa/qfa/evaluator"
+	"github.com/tysufa/qfa/lexer"
+	"github.com/tysufa/qfa/object"
+	"github.com/tysufa/qfa/optimizer"
+	"github.com/tysufa/qfa/parser"
 	"github.com/tysufa/qfa/repl"
+	"github.com/tysufa/qfa/vm"
 )
 
 func main() {
-	repl.Run()
+	engine := flag.String("engine", "eval", "what runs the programs: eval for the evaluator or vm for the bytecode vm")
+	flag.Parse()
+
+	if *engine != "eval" && *engine != "vm" {
+		fmt.Fprintf(os.Stderr, "unknown engine %q, expected eval or vm\n", *engine)
+		os.Exit(2)
+	}
+
+	if flag.NArg() > 0 {
+		os.Exit(runFile(flag.Arg(0), *engine, os.Stderr))
+	}
+	repl.Run(*engine)
+}
+
+// runFile executes the script at path and returns the exit status of the
+// program, the errors are reported to diagnostics
+func runFile(path string, engine string, diagnostics io.Writer) int {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(diagnostics, err)
+		return 1
+	}
+
+	p := parser.New(lexer.NewFile(path, string(source)))
+	program := p.GetStatements()
+	if len(p.Errors) > 0 {
+		for _, err := range p.Errors {
+			fmt.Fprintln(diagnostics, err)
+		}
+		return 1
+	}
+	optimizer.Optimize(&program)
+
+	var result object.Object
+	if engine == "vm" {
+		c := compiler.New()
+		if err := c.Compile(&program); err != nil {
+			fmt.Fprintln(diagnostics, err)
+			return 1
+		}
+		result = vm.New(c.Bytecode()).Run()
+	} else {
+		results := evaluator.EvaluateProgram(program.Statements, object.NewEnvironment())
+		if len(results) > 0 {
+			result = results[len(results)-1]
+		}
+	}
+
+	if err, ok := result.(*object.Error); ok {
+		fmt.Fprint(diagnostics, err.Inspect())
+		return 1
+	}
+	return 0
 }
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunFileStatus(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedStatus int
+	}{
+		{"let x = 1; print(x);", 0},
+		{"1 / 0;", 1},
+		{"if (true) { let y = 1 / 0; }", 1},
+		{"try { throw 1; } finally {}", 1},
+		{`try { throw 1; } catch (e) { throw "again"; }`, 1},
+		{"let x = ;", 1},
+	}
+
+	path := filepath.Join(t.TempDir(), "main.qfa")
+	for _, tt := range tests {
+		if err := os.WriteFile(path, []byte(tt.input), 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, engine := range []string{"eval", "vm"} {
+			if status := runFile(path, engine, io.Discard); status != tt.expectedStatus {
+				t.Errorf("%s engine: wrong status for %q. expected=%d, got=%d", engine, tt.input, tt.expectedStatus, status)
+			}
+		}
+	}
+}
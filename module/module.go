@@ -0,0 +1,108 @@
+// Package module finds and parses the files imported by a program
+package module
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tysufa/qfa/ast"
+	"github.com/tysufa/qfa/lexer"
+	"github.com/tysufa/qfa/object"
+	"github.com/tysufa/qfa/optimizer"
+	"github.com/tysufa/qfa/parser"
+)
+
+// PathVariable is the environment variable listing the directories searched
+// for the imports that aren't next to the importing file, separated like PATH
+const PathVariable = "QFA_PATH"
+
+// Find gives the absolute path of the file imported as path by the file
+// importer, which is empty for the repl. A relative path is looked for in the
+// directory of importer, the working directory for the repl, then in every
+// directory of QFA_PATH
+func Find(path, importer string) (string, error) {
+	if filepath.IsAbs(path) {
+		if isFile(path) {
+			return filepath.Clean(path), nil
+		}
+		return "", fmt.Errorf("module not found: %s", path)
+	}
+
+	dirs := []string{filepath.Dir(importer)}
+	if importer == "" {
+		dirs[0] = "."
+	}
+	for _, dir := range filepath.SplitList(os.Getenv(PathVariable)) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	for _, dir := range dirs {
+		file := filepath.Join(dir, path)
+		if isFile(file) {
+			return filepath.Abs(file)
+		}
+	}
+	return "", fmt.Errorf("module not found: %s", path)
+}
+
+// Load parses and optimizes the file at path. The positions of the program are
+// in the file named relative to the working directory when it is inside it
+func Load(path string) (*ast.Program, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser.New(lexer.NewFile(displayName(path), string(source)))
+	program := p.GetStatements()
+	if len(p.Errors) > 0 {
+		return nil, errors.New(p.Errors[0])
+	}
+	optimizer.Optimize(&program)
+	return &program, nil
+}
+
+// Cycle describes the chain of imports going back to the file at path,
+// imported as name, if it is the file importer that started the imports or
+// one of the modules being loaded. It gives "" when there is no cycle
+func Cycle(importer string, loading []*object.Module, path, name string) string {
+	chain := loading
+	if importer != "" {
+		if root, err := filepath.Abs(importer); err == nil {
+			chain = append([]*object.Module{{Name: importer, Path: root}}, loading...)
+		}
+	}
+
+	for i, mod := range chain {
+		if mod.Path == path {
+			names := []string{}
+			for _, mod := range chain[i:] {
+				names = append(names, mod.Name)
+			}
+			return strings.Join(append(names, name), " -> ")
+		}
+	}
+	return ""
+}
+
+func displayName(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,374 @@
+package object
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strings"
+)
+
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
+type BuiltinFunction func(args ...Object) Object
+
+// Budget reports the error to return when n more objects can't be created
+// within the limits of the running program, or once it ran out of time
+type Budget func(n int) *Error
+
+type Builtin struct {
+	Name string
+	Fn   BuiltinFunction
+	// Budgeted, when set, replaces Fn for the builtins which can create many
+	// objects: they check the budget before creating them
+	Budgeted func(budget Budget, args ...Object) Object
+}
+
+// Call calls the builtin with args within budget, which can be nil when the
+// program has no limits
+func (b *Builtin) Call(budget Budget, args ...Object) Object {
+	if b.Budgeted != nil {
+		return b.Budgeted(budget, args...)
+	}
+	return b.Fn(args...)
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin function " + b.Name + "\n" }
+
+// Builtins are the functions implemented in Go available to every program,
+// they are looked up once an identifier isn't found in the environment
+var Builtins = []*Builtin{
+	{Name: "len", Fn: builtinLen},
+	{Name: "type", Fn: builtinType},
+	{Name: "push", Fn: builtinPush},
+	{Name: "first", Fn: builtinFirst},
+	{Name: "last", Fn: builtinLast},
+	{Name: "rest", Fn: builtinRest},
+	{Name: "keys", Fn: builtinKeys},
+	{Name: "values", Fn: builtinValues},
+	{Name: "str", Fn: builtinStr},
+	{Name: "int", Fn: builtinInt},
+	{Name: "bool", Fn: builtinBool},
+	{Name: "array", Fn: builtinArray, Budgeted: budgetedArray},
+	{Name: "range", Fn: builtinRange, Budgeted: budgetedRange},
+}
+
+func GetBuiltinByName(name string) *Builtin {
+	for _, builtin := range Builtins {
+		if builtin.Name == name {
+			return builtin
+		}
+	}
+	return nil
+}
+
+// Print writes args separated by spaces on a line of w, as the print statement
+// does: strings without their quotes
+func Print(w io.Writer, args []Object) *Error {
+	values := make([]string, 0, len(args))
+	for _, arg := range args {
+		if str, ok := arg.(*String); ok {
+			values = append(values, str.Value)
+		} else if arg != nil {
+			values = append(values, strings.TrimSuffix(arg.Inspect(), "\n"))
+		}
+	}
+
+	if _, err := fmt.Fprintln(w, strings.Join(values, " ")); err != nil {
+		return NewError("could not print: %v", err)
+	}
+	return nil
+}
+
+func NewError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// IsTruthy tells whether obj counts as true in a condition: only null and false don't
+func IsTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Null:
+		return false
+	case *Boolean:
+		return obj.Value
+	default:
+		return true
+	}
+}
+
+func checkArgsNumber(name string, args []Object, expected int) *Error {
+	if len(args) != expected {
+		return NewError("wrong number of arguments to %s: expected %d, got %d", name, expected, len(args))
+	}
+	return nil
+}
+
+func builtinLen(args ...Object) Object {
+	if err := checkArgsNumber("len", args, 1); err != nil {
+		return err
+	}
+
+	switch arg := args[0].(type) {
+	case *String:
+		return &Integer{Value: len([]rune(arg.Value))}
+	case *Array:
+		return &Integer{Value: len(arg.Elements)}
+	case *Hash:
+		return &Integer{Value: len(arg.Pairs)}
+	case *Range:
+		return arg.Len()
+	default:
+		return NewError("argument to len not supported, got %s", args[0].Type())
+	}
+}
+
+func builtinType(args ...Object) Object {
+	if err := checkArgsNumber("type", args, 1); err != nil {
+		return err
+	}
+	return &String{Value: string(args[0].Type())}
+}
+
+func builtinPush(args ...Object) Object {
+	if err := checkArgsNumber("push", args, 2); err != nil {
+		return err
+	}
+	array, ok := args[0].(*Array)
+	if !ok {
+		return NewError("first argument to push must be ARRAY, got %s", args[0].Type())
+	}
+
+	elements := make([]Object, len(array.Elements), len(array.Elements)+1)
+	copy(elements, array.Elements)
+	return &Array{Elements: append(elements, args[1])}
+}
+
+func builtinFirst(args ...Object) Object {
+	if err := checkArgsNumber("first", args, 1); err != nil {
+		return err
+	}
+	array, ok := args[0].(*Array)
+	if !ok {
+		return NewError("argument to first must be ARRAY, got %s", args[0].Type())
+	}
+
+	if len(array.Elements) == 0 {
+		return NULL
+	}
+	return array.Elements[0]
+}
+
+func builtinLast(args ...Object) Object {
+	if err := checkArgsNumber("last", args, 1); err != nil {
+		return err
+	}
+	array, ok := args[0].(*Array)
+	if !ok {
+		return NewError("argument to last must be ARRAY, got %s", args[0].Type())
+	}
+
+	if len(array.Elements) == 0 {
+		return NULL
+	}
+	return array.Elements[len(array.Elements)-1]
+}
+
+func builtinRest(args ...Object) Object {
+	if err := checkArgsNumber("rest", args, 1); err != nil {
+		return err
+	}
+	array, ok := args[0].(*Array)
+	if !ok {
+		return NewError("argument to rest must be ARRAY, got %s", args[0].Type())
+	}
+
+	if len(array.Elements) == 0 {
+		return NULL
+	}
+	elements := make([]Object, len(array.Elements)-1)
+	copy(elements, array.Elements[1:])
+	return &Array{Elements: elements}
+}
+
+func builtinKeys(args ...Object) Object {
+	if err := checkArgsNumber("keys", args, 1); err != nil {
+		return err
+	}
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return NewError("argument to keys must be HASH, got %s", args[0].Type())
+	}
+
+	elements := make([]Object, 0, len(hash.Keys))
+	for _, key := range hash.Keys {
+		elements = append(elements, hash.Pairs[key].Key)
+	}
+	return &Array{Elements: elements}
+}
+
+func builtinValues(args ...Object) Object {
+	if err := checkArgsNumber("values", args, 1); err != nil {
+		return err
+	}
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return NewError("argument to values must be HASH, got %s", args[0].Type())
+	}
+
+	elements := make([]Object, 0, len(hash.Keys))
+	for _, key := range hash.Keys {
+		elements = append(elements, hash.Pairs[key].Value)
+	}
+	return &Array{Elements: elements}
+}
+
+func builtinStr(args ...Object) Object {
+	if err := checkArgsNumber("str", args, 1); err != nil {
+		return err
+	}
+	if str, ok := args[0].(*String); ok {
+		return str
+	}
+	return &String{Value: strings.TrimSuffix(args[0].Inspect(), "\n")}
+}
+
+func builtinInt(args ...Object) Object {
+	if err := checkArgsNumber("int", args, 1); err != nil {
+		return err
+	}
+
+	switch arg := args[0].(type) {
+	case *Integer:
+		return arg
+	case *Float:
+		return floatToInteger(arg.Value)
+	case *Boolean:
+		if arg.Value {
+			return &Integer{Value: 1}
+		}
+		return &Integer{Value: 0}
+	case *String:
+		value, ok := new(big.Int).SetString(strings.TrimSpace(arg.Value), 10)
+		if !ok {
+			return NewError("could not convert %q to an integer", arg.Value)
+		}
+		return NewBigInteger(value)
+	default:
+		return NewError("argument to int not supported, got %s", args[0].Type())
+	}
+}
+
+// floatToInteger truncates value towards zero
+func floatToInteger(value float64) Object {
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return NewError("could not convert %s to an integer", strings.TrimSuffix((&Float{Value: value}).Inspect(), "\n"))
+	}
+	integer, _ := big.NewFloat(value).Int(nil)
+	return NewBigInteger(integer)
+}
+
+func builtinBool(args ...Object) Object {
+	if err := checkArgsNumber("bool", args, 1); err != nil {
+		return err
+	}
+	if IsTruthy(args[0]) {
+		return TRUE
+	}
+	return FALSE
+}
+
+// builtinArray gives the elements a for in loop goes through as an array
+func builtinArray(args ...Object) Object {
+	return budgetedArray(nil, args...)
+}
+
+func budgetedArray(budget Budget, args ...Object) Object {
+	if err := checkArgsNumber("array", args, 1); err != nil {
+		return err
+	}
+	if array, ok := args[0].(*Array); ok {
+		return array
+	}
+	// only a range can have many more elements than the memory it takes
+	n := 0
+	if r, ok := args[0].(*Range); ok {
+		length := r.Len()
+		if length.Big != nil {
+			return NewError("range too large for an array: %s", strings.TrimSuffix(r.Inspect(), "\n"))
+		}
+		n = length.Value
+	}
+
+	it, err := Iterate(args[0])
+	if err != nil {
+		return err
+	}
+	return collect(budget, n, it)
+}
+
+// builtinRange mimics python's range: range(end), range(start, end) and range(start, end, step)
+func builtinRange(args ...Object) Object {
+	return budgetedRange(nil, args...)
+}
+
+func budgetedRange(budget Budget, args ...Object) Object {
+	if len(args) < 1 || len(args) > 3 {
+		return NewError("wrong number of arguments to range: expected 1 to 3, got %d", len(args))
+	}
+
+	bounds := []int{}
+	for _, arg := range args {
+		integer, ok := arg.(*Integer)
+		if !ok {
+			return NewError("arguments to range must be INTEGER, got %s", arg.Type())
+		}
+		if integer.Big != nil {
+			return NewError("range bound too large: %s", integer.Big)
+		}
+		bounds = append(bounds, integer.Value)
+	}
+
+	start, end, step := 0, bounds[0], 1
+	if len(bounds) > 1 {
+		start, end = bounds[0], bounds[1]
+	}
+	if len(bounds) > 2 {
+		step = bounds[2]
+	}
+	r := NewRange(&Integer{Value: start}, &Integer{Value: end}, &Integer{Value: step}, false)
+	if _, ok := r.(*Range); !ok {
+		return r
+	}
+	return budgetedArray(budget, r)
+}
+
+// budgetInterval is the number of elements collect creates between two
+// checks of the budget
+const budgetInterval = 1024
+
+// collect gathers the elements of it into an array, n of which are created.
+// The budget, when there is one, is checked for them before creating any,
+// then regularly for the time spent going through it
+func collect(budget Budget, n int, it *Iterator) Object {
+	if budget != nil {
+		if err := budget(n); err != nil {
+			return err
+		}
+	}
+
+	elements := []Object{}
+	for key, value, ok := it.Next(); ok; key, value, ok = it.Next() {
+		elements = append(elements, it.Element(key, value))
+		if budget != nil && len(elements)%budgetInterval == 0 {
+			if err := budget(0); err != nil {
+				return err
+			}
+		}
+	}
+	return &Array{Elements: elements}
+}
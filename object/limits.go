@@ -0,0 +1,109 @@
+package object
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultMaxCallDepth is the number of nested function calls the evaluator and
+// the vm allow by default, well below what would exhaust the Go stack
+const DefaultMaxCallDepth = 10000
+
+// Limits bounds the resources a program can use, a zero field means no limit.
+// A program going over a limit, or whose context is done, stops with an
+// "execution limit exceeded" error that try blocks can't catch
+type Limits struct {
+	MaxSteps       int           // nodes evaluated by the evaluator, instructions run by the vm
+	MaxDuration    time.Duration // wall time
+	MaxAllocations int           // objects created, an array or a hash counts one per element on top of itself
+}
+
+// checkInterval is the number of steps between two checks of the context and
+// of the wall time, which are too slow to be done at every step
+const checkInterval = 1024
+
+// Usage counts the resources used by the program being run and checks them
+// against its limits. The zero value has no limit
+type Usage struct {
+	limits      Limits
+	ctx         context.Context
+	deadline    time.Time
+	steps       int
+	allocations int
+}
+
+// Start starts counting for a program run with limits, until ctx is done
+func (u *Usage) Start(ctx context.Context, limits Limits) {
+	*u = Usage{limits: limits, ctx: ctx}
+	if limits.MaxDuration > 0 {
+		u.deadline = time.Now().Add(limits.MaxDuration)
+	}
+}
+
+// Stop forgets the context of the program, once it ended
+func (u *Usage) Stop() {
+	u.ctx = nil
+}
+
+// Step counts a step of the program and reports an error once a limit is exceeded
+func (u *Usage) Step() *Error {
+	u.steps++
+	if u.limits.MaxSteps > 0 && u.steps > u.limits.MaxSteps {
+		return limitErr("more than %d steps", u.limits.MaxSteps)
+	}
+
+	if u.steps%checkInterval == 0 {
+		return u.interrupted()
+	}
+	return nil
+}
+
+// interrupted reports an error once the context is done or the time is up
+func (u *Usage) interrupted() *Error {
+	if u.ctx != nil && u.ctx.Err() != nil {
+		return limitErr("%v", u.ctx.Err())
+	}
+	if !u.deadline.IsZero() && time.Now().After(u.deadline) {
+		return limitErr("ran for more than %v", u.limits.MaxDuration)
+	}
+	return nil
+}
+
+// Budget is the Budget of the builtins: it reports an error when n more
+// objects would exceed the allocations limit, without counting them since
+// Allocate does once they are created
+func (u *Usage) Budget(n int) *Error {
+	if u.limits.MaxAllocations > 0 && n > u.limits.MaxAllocations-u.allocations {
+		return limitErr("more than %d objects allocated", u.limits.MaxAllocations)
+	}
+	return u.interrupted()
+}
+
+// Allocate counts the objects making up obj, which was just created, and
+// reports an error instead once there are too many
+func (u *Usage) Allocate(obj Object) Object {
+	if u.limits.MaxAllocations == 0 {
+		return obj
+	}
+
+	switch obj := obj.(type) {
+	case nil, *Error, *Boolean, *Null:
+		return obj
+	case *Array:
+		u.allocations += 1 + len(obj.Elements)
+	case *Hash:
+		u.allocations += 1 + len(obj.Pairs)
+	default:
+		u.allocations++
+	}
+
+	if u.allocations > u.limits.MaxAllocations {
+		return limitErr("more than %d objects allocated", u.limits.MaxAllocations)
+	}
+	return obj
+}
+
+func limitErr(format string, a ...interface{}) *Error {
+	return &Error{Message: "execution limit exceeded: " + fmt.Sprintf(format, a...), Fatal: true}
+}
@@ -0,0 +1,255 @@
+package object
+
+import (
+	"math"
+	"math/big"
+	"strings"
+)
+
+// Math is the standard module of the mathematical functions and constants,
+// imported with import "math" as math;
+var Math = &Module{Name: "math", Get: func(name string) (Object, bool) {
+	member, ok := mathMembers[name]
+	return member, ok
+}}
+
+var mathMembers = map[string]Object{
+	"pi":    &Float{Value: math.Pi},
+	"e":     &Float{Value: math.E},
+	"abs":   &Builtin{Name: "math.abs", Fn: mathAbs},
+	"min":   &Builtin{Name: "math.min", Fn: func(args ...Object) Object { return mathExtremum("math.min", "<", args) }},
+	"max":   &Builtin{Name: "math.max", Fn: func(args ...Object) Object { return mathExtremum("math.max", ">", args) }},
+	"floor": &Builtin{Name: "math.floor", Fn: mathRounding("math.floor", math.Floor)},
+	"ceil":  &Builtin{Name: "math.ceil", Fn: mathRounding("math.ceil", math.Ceil)},
+	"round": &Builtin{Name: "math.round", Fn: mathRounding("math.round", math.Round)},
+	"sqrt":  &Builtin{Name: "math.sqrt", Fn: mathSqrt},
+	"pow":   &Builtin{Name: "math.pow", Fn: mathPow},
+	"log":   &Builtin{Name: "math.log", Fn: mathLog},
+	"exp":   &Builtin{Name: "math.exp", Fn: mathFunction("math.exp", math.Exp)},
+	"sin":   &Builtin{Name: "math.sin", Fn: mathFunction("math.sin", math.Sin)},
+	"cos":   &Builtin{Name: "math.cos", Fn: mathFunction("math.cos", math.Cos)},
+	"tan":   &Builtin{Name: "math.tan", Fn: mathFunction("math.tan", math.Tan)},
+	"asin":  &Builtin{Name: "math.asin", Fn: mathFunction("math.asin", math.Asin)},
+	"acos":  &Builtin{Name: "math.acos", Fn: mathFunction("math.acos", math.Acos)},
+	"atan":  &Builtin{Name: "math.atan", Fn: mathFunction("math.atan", math.Atan)},
+	"atan2": &Builtin{Name: "math.atan2", Fn: mathAtan2},
+	"gcd":   &Builtin{Name: "math.gcd", Fn: func(args ...Object) Object { return mathGcdLcm("math.gcd", args) }},
+	"lcm":   &Builtin{Name: "math.lcm", Fn: func(args ...Object) Object { return mathGcdLcm("math.lcm", args) }},
+}
+
+// StandardModules are the modules provided by the interpreter, imported by
+// name rather than from a file
+var StandardModules = []*Module{Math}
+
+func GetStandardModule(name string) *Module {
+	for _, mod := range StandardModules {
+		if mod.Name == name {
+			return mod
+		}
+	}
+	return nil
+}
+
+func checkNumber(name string, arg Object) *Error {
+	if !isNumber(arg) {
+		return NewError("argument to %s must be INTEGER or FLOAT, got %s", name, arg.Type())
+	}
+	return nil
+}
+
+func checkInteger(name string, arg Object) (*Integer, *Error) {
+	integer, ok := arg.(*Integer)
+	if !ok {
+		return nil, NewError("argument to %s must be INTEGER, got %s", name, arg.Type())
+	}
+	return integer, nil
+}
+
+func mathAbs(args ...Object) Object {
+	if err := checkArgsNumber("math.abs", args, 1); err != nil {
+		return err
+	}
+	switch arg := args[0].(type) {
+	case *Integer:
+		// -math.MinInt doesn't fit in an int
+		if arg.Big != nil || arg.Value == math.MinInt {
+			return NewBigInteger(new(big.Int).Abs(arg.BigValue()))
+		}
+		if arg.Value < 0 {
+			return &Integer{Value: -arg.Value}
+		}
+		return arg
+	case *Float:
+		return &Float{Value: math.Abs(arg.Value)}
+	default:
+		return checkNumber("math.abs", arg)
+	}
+}
+
+// mathExtremum gives the argument x for which x operator y holds for every
+// other argument y, the arguments being numbers or a single array of numbers
+func mathExtremum(name, operator string, args []Object) Object {
+	if len(args) == 1 {
+		if array, ok := args[0].(*Array); ok {
+			args = array.Elements
+		}
+	}
+	if len(args) == 0 {
+		return NewError("%s of no value", name)
+	}
+
+	result := args[0]
+	for _, arg := range args {
+		if err := checkNumber(name, arg); err != nil {
+			return err
+		}
+		if InfixOperator(operator, arg, result) == TRUE {
+			result = arg
+		}
+	}
+	return result
+}
+
+// mathRounding creates a function rounding a float to an integer with round,
+// the integers being left as they are
+func mathRounding(name string, round func(float64) float64) BuiltinFunction {
+	return func(args ...Object) Object {
+		if err := checkArgsNumber(name, args, 1); err != nil {
+			return err
+		}
+		switch arg := args[0].(type) {
+		case *Integer:
+			return arg
+		case *Float:
+			return floatToInteger(round(arg.Value))
+		default:
+			return checkNumber(name, arg)
+		}
+	}
+}
+
+// mathFunction creates a function applying fn to a number, giving a float
+func mathFunction(name string, fn func(float64) float64) BuiltinFunction {
+	return func(args ...Object) Object {
+		if err := checkArgsNumber(name, args, 1); err != nil {
+			return err
+		}
+		if err := checkNumber(name, args[0]); err != nil {
+			return err
+		}
+		return &Float{Value: fn(toFloat(args[0]))}
+	}
+}
+
+func mathSqrt(args ...Object) Object {
+	if err := checkArgsNumber("math.sqrt", args, 1); err != nil {
+		return err
+	}
+	if err := checkNumber("math.sqrt", args[0]); err != nil {
+		return err
+	}
+	if InfixOperator("<", args[0], &Integer{Value: 0}) == TRUE {
+		return NewError("math.sqrt of a negative number: %s", strings.TrimSuffix(args[0].Inspect(), "\n"))
+	}
+
+	if integer, ok := args[0].(*Integer); ok && integer.Big != nil {
+		// too large for a float before the square root is taken
+		root, _ := new(big.Float).Sqrt(new(big.Float).SetInt(integer.Big)).Float64()
+		return &Float{Value: root}
+	}
+	return &Float{Value: math.Sqrt(toFloat(args[0]))}
+}
+
+// mathPow is the ** operator: exact, growing into a big integer if needed,
+// for integers
+func mathPow(args ...Object) Object {
+	if err := checkArgsNumber("math.pow", args, 2); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if err := checkNumber("math.pow", arg); err != nil {
+			return err
+		}
+	}
+	return InfixOperator("**", args[0], args[1])
+}
+
+// mathLog gives the natural logarithm of its first argument, or its logarithm
+// in the base given as second argument
+func mathLog(args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return NewError("wrong number of arguments to math.log: expected 1 or 2, got %d", len(args))
+	}
+
+	logs := []float64{}
+	for _, arg := range args {
+		if err := checkNumber("math.log", arg); err != nil {
+			return err
+		}
+		if InfixOperator("<=", arg, &Integer{Value: 0}) == TRUE {
+			return NewError("math.log of a non-positive number: %s", strings.TrimSuffix(arg.Inspect(), "\n"))
+		}
+		logs = append(logs, naturalLog(arg))
+	}
+
+	if len(logs) == 2 {
+		if logs[1] == 0 {
+			return NewError("math.log in base 1")
+		}
+		return &Float{Value: logs[0] / logs[1]}
+	}
+	return &Float{Value: logs[0]}
+}
+
+// naturalLog gives the logarithm of a positive number, including the integers
+// too large to be converted to a float
+func naturalLog(number Object) float64 {
+	integer, ok := number.(*Integer)
+	if !ok || integer.Big == nil {
+		return math.Log(toFloat(number))
+	}
+	// number = mantissa * 2**exp with mantissa in [0.5, 1)
+	mantissa := new(big.Float)
+	exp := new(big.Float).SetInt(integer.Big).MantExp(mantissa)
+	m, _ := mantissa.Float64()
+	return math.Log(m) + float64(exp)*math.Ln2
+}
+
+func mathAtan2(args ...Object) Object {
+	if err := checkArgsNumber("math.atan2", args, 2); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if err := checkNumber("math.atan2", arg); err != nil {
+			return err
+		}
+	}
+	return &Float{Value: math.Atan2(toFloat(args[0]), toFloat(args[1]))}
+}
+
+// mathGcdLcm gives the greatest common divisor or the least common multiple of
+// two integers, which is never negative
+func mathGcdLcm(name string, args []Object) Object {
+	if err := checkArgsNumber(name, args, 2); err != nil {
+		return err
+	}
+	a, err := checkInteger(name, args[0])
+	if err != nil {
+		return err
+	}
+	b, err := checkInteger(name, args[1])
+	if err != nil {
+		return err
+	}
+
+	x := new(big.Int).Abs(a.BigValue())
+	y := new(big.Int).Abs(b.BigValue())
+	gcd := new(big.Int).GCD(nil, nil, x, y)
+	if name == "math.gcd" {
+		return NewBigInteger(gcd)
+	}
+	if gcd.Sign() == 0 {
+		return &Integer{Value: 0}
+	}
+	return NewBigInteger(x.Mul(x.Quo(x, gcd), y))
+}
@@ -3,17 +3,41 @@ package object
 import (
 	"bytes"
 	"fmt"
+	"hash/fnv"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tysufa/qfa/ast"
+	"github.com/tysufa/qfa/code"
+	"github.com/tysufa/qfa/token"
 )
 
 type ObjectType string
 
 const (
-	INTEGER_OBJ = "INTEGER"
-	RETURN_OBJ  = "RETURN"
-	BOOLEAN_OBJ = "BOOLEAN"
-	NULL_OBJ    = "NULL"
-	BLOCK_OBJ   = "BLOCK"
-	ERROR_OBJ   = "ERROR"
+	INTEGER_OBJ   = "INTEGER"
+	FLOAT_OBJ     = "FLOAT"
+	RETURN_OBJ    = "RETURN"
+	BOOLEAN_OBJ   = "BOOLEAN"
+	STRING_OBJ    = "STRING"
+	ARRAY_OBJ     = "ARRAY"
+	HASH_OBJ      = "HASH"
+	NULL_OBJ      = "NULL"
+	BLOCK_OBJ     = "BLOCK"
+	ERROR_OBJ     = "ERROR"
+	FUNCTION_OBJ  = "FUNCTION"
+	BUILTIN_OBJ   = "BUILTIN"
+	BREAK_OBJ     = "BREAK"
+	CONTINUE_OBJ  = "CONTINUE"
+	TAIL_CALL_OBJ = "TAIL_CALL"
+	MODULE_OBJ    = "MODULE"
+	ITERATOR_OBJ  = "ITERATOR"
+	RANGE_OBJ     = "RANGE"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
 )
 
 type Object interface {
@@ -22,29 +46,158 @@ type Object interface {
 }
 
 func NewEnvironment() *Environment {
-	s := make(map[string]Object)
-	return &Environment{store: s}
+	env := &Environment{names: make(map[string]int)}
+	env.globals = env
+	return env
 }
 
+// NewEnclosedEnvironment creates the environment of a scope nested in outer
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	return &Environment{outer: outer, globals: outer.globals}
+}
+
+// Environment holds the variables of a scope by the index the resolver gave
+// them. The outermost environment holds the globals, whose indexes it numbers
+// itself so that the programs resolved one after the other in it, as in the
+// repl, share them
 type Environment struct {
-	store map[string]Object
+	names   map[string]int // index of every global, only used by the outermost environment
+	slots   []Object
+	outer   *Environment
+	globals *Environment
+}
+
+// Index gives the index of the global name, numbering it the first time
+func (e *Environment) Index(name string) int {
+	index, ok := e.globals.names[name]
+	if !ok {
+		index = len(e.globals.names)
+		e.globals.names[name] = index
+	}
+	return index
 }
 
+// Defined tells whether the global name was declared
+func (e *Environment) Defined(name string) bool {
+	_, ok := e.Get(name)
+	return ok
+}
+
+// Get looks up the global name
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
-	return obj, ok
+	index, ok := e.globals.names[name]
+	if !ok {
+		return nil, false
+	}
+	obj := e.GetGlobal(index)
+	return obj, obj != nil
 }
+
+// Set declares the global name, or updates it if it already exists
 func (e *Environment) Set(name string, val Object) Object {
-	e.store[name] = val
+	return e.SetGlobal(e.Index(name), val)
+}
+
+// GetGlobal gives the global at index, nil if it wasn't declared yet
+func (e *Environment) GetGlobal(index int) Object {
+	return e.globals.GetSlot(0, index)
+}
+
+// SetGlobal sets the global at index
+func (e *Environment) SetGlobal(index int, val Object) Object {
+	return e.globals.SetSlot(0, index, val)
+}
+
+// GetSlot gives the local variable at index in the scope depth levels above e,
+// nil if it wasn't declared yet
+func (e *Environment) GetSlot(depth, index int) Object {
+	env := e.ancestor(depth)
+	if index >= len(env.slots) {
+		return nil
+	}
+	return env.slots[index]
+}
+
+// SetSlot sets the local variable at index in the scope depth levels above e
+func (e *Environment) SetSlot(depth, index int, val Object) Object {
+	env := e.ancestor(depth)
+	if index >= len(env.slots) {
+		env.slots = append(env.slots, make([]Object, index+1-len(env.slots))...)
+	}
+	env.slots[index] = val
 	return val
 }
 
+func (e *Environment) ancestor(depth int) *Environment {
+	env := e
+	for i := 0; i < depth; i++ {
+		env = env.outer
+	}
+	return env
+}
+
+// Frame is a call of a function that was running when an error occurred
+type Frame struct {
+	Function string // empty for an anonymous function
+	File     string
+	Line     int // position of the call
+	Column   int
+}
+
 type Error struct {
 	Message string
+	File    string
+	Line    int // 0 when unknown
+	Column  int
+	Stack   []Frame // innermost call first
+	Fatal   bool    // set for the errors try blocks can't catch
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR : " + e.Message + "\n" }
+
+// Inspect gives the message and where it happened, followed by one line for each
+// function call that led there
+func (e *Error) Inspect() string {
+	var out bytes.Buffer
+
+	out.WriteString("ERROR : " + e.Message)
+	if e.Line > 0 {
+		out.WriteString(" at " + position(e.File, e.Line, e.Column))
+	}
+	out.WriteString("\n")
+
+	for i, frame := range e.Stack {
+		if len(e.Stack) > maxInspectedFrames && i >= maxInspectedFrames/2 && i < len(e.Stack)-maxInspectedFrames/2 {
+			if i == maxInspectedFrames/2 {
+				out.WriteString(fmt.Sprintf("  ... %d more calls\n", len(e.Stack)-maxInspectedFrames))
+			}
+			continue
+		}
+		name := frame.Function
+		if name == "" {
+			name = "anonymous function"
+		}
+		out.WriteString(fmt.Sprintf("  in %s called at %s\n", name, position(frame.File, frame.Line, frame.Column)))
+	}
+
+	return out.String()
+}
+
+// maxInspectedFrames is the number of frames Inspect shows, the middle of
+// longer stacks is left out
+const maxInspectedFrames = 20
+
+// position formats a location as file:line:column, or line N, column M when
+// the source doesn't come from a file
+func position(file string, line, column int) string {
+	if file != "" {
+		return fmt.Sprintf("%s:%d:%d", file, line, column)
+	}
+	if column > 0 {
+		return fmt.Sprintf("line %d, column %d", line, column)
+	}
+	return fmt.Sprintf("line %d", line)
+}
 
 type BlockObject struct {
 	Block  []Object
@@ -55,9 +208,9 @@ func (bo *BlockObject) Type() ObjectType { return BLOCK_OBJ }
 func (bo *BlockObject) Inspect() string {
 	var res bytes.Buffer
 	for _, obj := range bo.Block {
-    if obj != nil{
-      res.WriteString(obj.Inspect())
-    }
+		if obj != nil {
+			res.WriteString(obj.Inspect())
+		}
 	}
 
 	return res.String()
@@ -75,12 +228,175 @@ type Return struct {
 func (r *Return) Type() ObjectType { return RETURN_OBJ }
 func (r *Return) Inspect() string  { return r.Value.Inspect() }
 
+// Break and Continue signal the nearest enclosing loop to stop or to skip to
+// its next iteration
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break\n" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue\n" }
+
+// TailCall is returned by a function instead of the result of a call in tail
+// position, the caller makes the call once the frame of the function is gone
+type TailCall struct {
+	Function  Object
+	Arguments []Object
+	Call      token.Token
+}
+
+func (tc *TailCall) Type() ObjectType { return TAIL_CALL_OBJ }
+func (tc *TailCall) Inspect() string  { return "tail call\n" }
+
+// Integer is an integer of arbitrary precision. Value holds it as long as it
+// fits in an int, otherwise Big holds it and Value is meaningless
 type Integer struct {
 	Value int
+	Big   *big.Int
+}
+
+// NewBigInteger returns the Integer of value, stored in Value whenever it fits
+func NewBigInteger(value *big.Int) *Integer {
+	if value.IsInt64() {
+		if v := value.Int64(); v >= math.MinInt && v <= math.MaxInt {
+			return &Integer{Value: int(v)}
+		}
+	}
+	return &Integer{Big: value}
+}
+
+// BigValue returns the value of i as a big.Int, it must not be modified
+func (i *Integer) BigValue() *big.Int {
+	if i.Big != nil {
+		return i.Big
+	}
+	return big.NewInt(int64(i.Value))
 }
 
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
-func (i *Integer) Inspect() string  { return fmt.Sprintf("%d\n", i.Value) }
+func (i *Integer) Inspect() string {
+	if i.Big != nil {
+		return i.Big.String() + "\n"
+	}
+	return fmt.Sprintf("%d\n", i.Value)
+}
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string {
+	res := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	// keep floats distinguishable from integers: 3.0 rather than 3
+	if !strings.ContainsAny(res, ".eIN") {
+		res += ".0"
+	}
+	return res + "\n"
+}
+
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value + "\n" }
+
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string {
+	elements := []string{}
+	for _, el := range a.Elements {
+		elements = append(elements, inspectInline(el))
+	}
+	return "[" + strings.Join(elements, ", ") + "]\n"
+}
+
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// Hashable is implemented by the objects that can be used as hash keys
+type Hashable interface {
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey {
+	if i.Big != nil {
+		h := fnv.New64a()
+		h.Write([]byte(i.Big.String()))
+		return HashKey{Type: i.Type(), Value: h.Sum64()}
+	}
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash remembers the order in which its keys were first inserted
+type Hash struct {
+	Pairs map[HashKey]HashPair
+	Keys  []HashKey
+}
+
+func NewHash() *Hash {
+	return &Hash{Pairs: make(map[HashKey]HashPair)}
+}
+
+func (h *Hash) Set(key Hashable, value Object) {
+	hashKey := key.HashKey()
+	if _, ok := h.Pairs[hashKey]; !ok {
+		h.Keys = append(h.Keys, hashKey)
+	}
+	h.Pairs[hashKey] = HashPair{Key: key.(Object), Value: value}
+}
+
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	pair, ok := h.Pairs[key.HashKey()]
+	return pair.Value, ok
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	pairs := []string{}
+	for _, key := range h.Keys {
+		pair := h.Pairs[key]
+		pairs = append(pairs, inspectInline(pair.Key)+": "+inspectInline(pair.Value))
+	}
+	return "{" + strings.Join(pairs, ", ") + "}\n"
+}
+
+// inspectInline gives the representation of an object nested in another one,
+// strings are quoted so that ["a, b"] and ["a", "b"] can be told apart
+func inspectInline(obj Object) string {
+	if str, ok := obj.(*String); ok {
+		return strconv.Quote(str.Value)
+	}
+	return strings.TrimSuffix(obj.Inspect(), "\n")
+}
 
 type Boolean struct {
 	Value bool
@@ -88,3 +404,222 @@ type Boolean struct {
 
 func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
 func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t\n", b.Value) }
+
+type Function struct {
+	Name       string // empty for an anonymous function
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString("){")
+	out.WriteString(f.Body.String())
+	out.WriteString("}\n")
+
+	return out.String()
+}
+
+// CompiledFunction is the bytecode of a function literal, it only lives in the
+// constant pool: running a function literal creates a Closure
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	Positions     []code.Position // sorted by offset
+	NumLocals     int             // parameters included
+	NumParameters int
+	Name          string // empty for an anonymous function
+	Literal       string // source of the function, shown by Inspect
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string  { return cf.Literal + "\n" }
+
+// TokenAt returns the token the instruction starting at offset was compiled from
+func (cf *CompiledFunction) TokenAt(offset int) token.Token {
+	i := sort.Search(len(cf.Positions), func(i int) bool { return cf.Positions[i].Offset > offset })
+	if i == 0 {
+		return token.Token{}
+	}
+	return cf.Positions[i-1].Token
+}
+
+// Scope holds the local variables of a function call or of a block run by the
+// vm, Outer is the scope the function was created in or the block is nested in
+type Scope struct {
+	Slots []Object
+	Outer *Scope
+}
+
+// CompiledFile holds what the code compiled from a file refers to by index:
+// its constants and its globals
+type CompiledFile struct {
+	Constants   []Object
+	Globals     []Object
+	GlobalNames []string
+}
+
+// Closure is a function of the vm, the scope it was created in is kept alive
+// for as long as the function is
+type Closure struct {
+	Fn    *CompiledFunction
+	Scope *Scope
+	File  *CompiledFile // file the function was compiled from
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string  { return c.Fn.Inspect() }
+
+// Module is an imported file, Get gives the globals it declared
+type Module struct {
+	Name string // path the file was imported as
+	Path string // absolute path of the file
+	Get  func(name string) (Object, bool)
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return fmt.Sprintf("module %q\n", m.Name) }
+
+// Iterator goes through the elements of a collection, see Iterate
+type Iterator struct {
+	next  func() (key, value Object, ok bool)
+	keyed bool // the elements are the keys rather than the values
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string  { return "iterator\n" }
+
+// Next gives the key and the value of the next element, ok is false once
+// there is none left
+func (it *Iterator) Next() (key, value Object, ok bool) {
+	return it.next()
+}
+
+// Element gives the element a loop with a single variable binds for the key
+// and value given by Next: the key of a hash, the value otherwise
+func (it *Iterator) Element(key, value Object) Object {
+	if it.keyed {
+		return key
+	}
+	return value
+}
+
+// Range is the sequence of integers start..end or start..=end going by step,
+// created with NewRange. Its elements are computed when needed, so that a
+// range can be as large as the integers allow
+type Range struct {
+	Start, End, Step int
+	Inclusive        bool // whether End is part of the range when step reaches it
+
+	empty bool
+	last  int    // last element, if the range isn't empty
+	span  uint64 // distance between Start and last
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+func (r *Range) Inspect() string {
+	operator := ".."
+	if r.Inclusive {
+		operator = "..="
+	}
+	out := strconv.Itoa(r.Start) + operator + strconv.Itoa(r.End)
+	if r.Step != 1 {
+		out += " step " + strconv.Itoa(r.Step)
+	}
+	return out + "\n"
+}
+
+// NewRange gives the range going from start to end by step, which goes down
+// when step is negative
+func NewRange(start, end, step Object, inclusive bool) Object {
+	bounds := []int{}
+	for _, bound := range []Object{start, end, step} {
+		integer, ok := bound.(*Integer)
+		if !ok {
+			return NewError("range bounds and step must be INTEGER, got %s", bound.Type())
+		}
+		if integer.Big != nil {
+			return NewError("range bound too large: %s", integer.Big)
+		}
+		bounds = append(bounds, integer.Value)
+	}
+
+	r := &Range{Start: bounds[0], End: bounds[1], Step: bounds[2], Inclusive: inclusive}
+	if r.Step == 0 {
+		return NewError("range step must not be zero")
+	}
+
+	// the distances are computed on uint64, where they can't overflow
+	last := r.End
+	if r.Step > 0 {
+		if !inclusive {
+			last--
+		}
+		r.empty = r.End < r.Start || (!inclusive && r.End == r.Start)
+		r.span = uint64(last) - uint64(r.Start)
+	} else {
+		if !inclusive {
+			last++
+		}
+		r.empty = r.End > r.Start || (!inclusive && r.End == r.Start)
+		r.span = uint64(r.Start) - uint64(last)
+	}
+	if !r.empty {
+		r.span -= r.span % r.absStep()
+		r.last = r.Start + int(r.span)*sign(r.Step)
+	}
+	return r
+}
+
+func (r *Range) absStep() uint64 {
+	if r.Step < 0 {
+		// also right for math.MinInt, whose opposite wraps to itself
+		return uint64(-r.Step)
+	}
+	return uint64(r.Step)
+}
+
+func sign(n int) int {
+	if n < 0 {
+		return -1
+	}
+	return 1
+}
+
+// Len gives the number of elements of r, which doesn't always fit in an int
+func (r *Range) Len() *Integer {
+	if r.empty {
+		return &Integer{Value: 0}
+	}
+	length := new(big.Int).SetUint64(r.span / r.absStep())
+	return NewBigInteger(length.Add(length, big.NewInt(1)))
+}
+
+// At gives the element at index i, ok is false if there is none
+func (r *Range) At(i int) (n int, ok bool) {
+	if r.empty || i < 0 || uint64(i) > r.span/r.absStep() {
+		return 0, false
+	}
+	// the product can overflow but the sum wraps back to the element
+	return r.Start + i*r.Step, true
+}
+
+// Contains tells whether n is one of the elements of r
+func (r *Range) Contains(n int) bool {
+	if r.empty {
+		return false
+	}
+	if r.Step > 0 {
+		return n >= r.Start && n <= r.last && (uint64(n)-uint64(r.Start))%r.absStep() == 0
+	}
+	return n <= r.Start && n >= r.last && (uint64(r.Start)-uint64(n))%r.absStep() == 0
+}
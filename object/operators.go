@@ -0,0 +1,632 @@
+package object
+
+import (
+	"math"
+	"math/big"
+	"strings"
+)
+
+// Truthiness selects how the conditions of if, while, ! and the logical
+// operators treat values that aren't booleans
+type Truthiness int
+
+const (
+	// Lenient treats null and false as false and every other value as true
+	Lenient Truthiness = iota
+	// Strict only accepts booleans and reports an error for any other value
+	Strict
+)
+
+// Truthy tells whether obj counts as true according to mode, in strict mode
+// what describes obj in the error reported for a value that isn't a boolean
+func Truthy(obj Object, mode Truthiness, what string) (bool, *Error) {
+	if mode == Strict && obj.Type() != BOOLEAN_OBJ {
+		return false, NewError("%s must be BOOLEAN, got %s", what, obj.Type())
+	}
+	return IsTruthy(obj), nil
+}
+
+// InfixOperator computes left operator right for every operator but the logical
+// ones, which need to short-circuit
+func InfixOperator(operator string, left, right Object) Object {
+	switch {
+	case operator == "in":
+		return Contains(right, left)
+	case isNumber(left) && isNumber(right) && (left.Type() == FLOAT_OBJ || right.Type() == FLOAT_OBJ):
+		return floatInfixOperator(operator, toFloat(left), toFloat(right))
+	case left.Type() != right.Type():
+		return NewError("type mismatch: %s%s%s", left.Type(), operator, right.Type())
+	case left.Type() == INTEGER_OBJ && right.Type() == INTEGER_OBJ:
+		return integerInfixOperator(operator, left, right)
+	case left.Type() == STRING_OBJ && right.Type() == STRING_OBJ:
+		return stringInfixOperator(operator, left, right)
+	case left.Type() == ARRAY_OBJ && right.Type() == ARRAY_OBJ && operator == "+":
+		leftElements := left.(*Array).Elements
+		rightElements := right.(*Array).Elements
+		elements := make([]Object, 0, len(leftElements)+len(rightElements))
+		elements = append(elements, leftElements...)
+		return &Array{Elements: append(elements, rightElements...)}
+	case operator == "==":
+		return BoolObject(left == right)
+	case operator == "!=":
+		return BoolObject(left != right)
+	default:
+		return NewError("unknown operator: %v%v%v", left.Type(), operator, right.Type())
+	}
+}
+
+// integerInfixOperator works on ints as long as the result fits in one and
+// switches to big integers otherwise
+func integerInfixOperator(operator string, left, right Object) Object {
+	leftInt := left.(*Integer)
+	rightInt := right.(*Integer)
+	if leftInt.Big != nil || rightInt.Big != nil {
+		return bigIntegerInfixOperator(operator, leftInt.BigValue(), rightInt.BigValue())
+	}
+
+	leftVal := leftInt.Value
+	rightVal := rightInt.Value
+	switch operator {
+	case "+":
+		sum := leftVal + rightVal
+		if (rightVal > 0 && sum < leftVal) || (rightVal < 0 && sum > leftVal) {
+			return bigIntegerInfixOperator(operator, leftInt.BigValue(), rightInt.BigValue())
+		}
+		return &Integer{Value: sum}
+	case "-":
+		diff := leftVal - rightVal
+		if (rightVal > 0 && diff > leftVal) || (rightVal < 0 && diff < leftVal) {
+			return bigIntegerInfixOperator(operator, leftInt.BigValue(), rightInt.BigValue())
+		}
+		return &Integer{Value: diff}
+	case "*":
+		product := leftVal * rightVal
+		if leftVal != 0 && (product/leftVal != rightVal || (leftVal == -1 && rightVal == math.MinInt)) {
+			return bigIntegerInfixOperator(operator, leftInt.BigValue(), rightInt.BigValue())
+		}
+		return &Integer{Value: product}
+	case "/":
+		if rightVal == 0 {
+			return NewError("division by zero")
+		}
+		if leftVal == math.MinInt && rightVal == -1 {
+			return bigIntegerInfixOperator(operator, leftInt.BigValue(), rightInt.BigValue())
+		}
+		return &Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return NewError("modulo by zero")
+		}
+		return &Integer{Value: leftVal % rightVal}
+	case "**":
+		if rightVal < 0 {
+			return &Float{Value: math.Pow(float64(leftVal), float64(rightVal))}
+		}
+		if leftVal >= -1 && leftVal <= 1 {
+			return bigIntegerInfixOperator(operator, leftInt.BigValue(), rightInt.BigValue())
+		}
+		// |leftVal| >= 2 so the loop overflows after at most 63 iterations
+		result := 1
+		for i := 0; i < rightVal; i++ {
+			next := result * leftVal
+			if next/leftVal != result {
+				return bigIntegerInfixOperator(operator, leftInt.BigValue(), rightInt.BigValue())
+			}
+			result = next
+		}
+		return &Integer{Value: result}
+	case "&":
+		return &Integer{Value: leftVal & rightVal}
+	case "|":
+		return &Integer{Value: leftVal | rightVal}
+	case "^":
+		return &Integer{Value: leftVal ^ rightVal}
+	case "<<":
+		if rightVal < 0 {
+			return NewError("negative shift count: %d", rightVal)
+		}
+		if rightVal >= 63 || leftVal<<rightVal>>rightVal != leftVal {
+			return bigIntegerInfixOperator(operator, leftInt.BigValue(), rightInt.BigValue())
+		}
+		return &Integer{Value: leftVal << rightVal}
+	case ">>":
+		if rightVal < 0 {
+			return NewError("negative shift count: %d", rightVal)
+		}
+		return &Integer{Value: leftVal >> rightVal}
+	case "==":
+		return BoolObject(leftVal == rightVal)
+	case "!=":
+		return BoolObject(leftVal != rightVal)
+	case ">":
+		return BoolObject(leftVal > rightVal)
+	case ">=":
+		return BoolObject(leftVal >= rightVal)
+	case "<":
+		return BoolObject(leftVal < rightVal)
+	case "<=":
+		return BoolObject(leftVal <= rightVal)
+	default:
+		return NewError("unknown operator: %v%v%v", left.Type(), operator, right.Type())
+	}
+}
+
+// maxIntegerBits bounds the size of the integers built by ** and <<, so that a
+// small expression can't exhaust the memory
+const maxIntegerBits = 1 << 24
+
+// bigIntegerInfixOperator computes with big integers, the result goes back to
+// a plain int whenever it fits in one
+func bigIntegerInfixOperator(operator string, leftVal, rightVal *big.Int) Object {
+	switch operator {
+	case "+":
+		return NewBigInteger(new(big.Int).Add(leftVal, rightVal))
+	case "-":
+		return NewBigInteger(new(big.Int).Sub(leftVal, rightVal))
+	case "*":
+		return NewBigInteger(new(big.Int).Mul(leftVal, rightVal))
+	case "/":
+		if rightVal.Sign() == 0 {
+			return NewError("division by zero")
+		}
+		// Quo truncates towards zero like the division of ints
+		return NewBigInteger(new(big.Int).Quo(leftVal, rightVal))
+	case "%":
+		if rightVal.Sign() == 0 {
+			return NewError("modulo by zero")
+		}
+		// Rem keeps the sign of the dividend like the modulo of ints
+		return NewBigInteger(new(big.Int).Rem(leftVal, rightVal))
+	case "**":
+		if rightVal.Sign() < 0 {
+			left, _ := new(big.Float).SetInt(leftVal).Float64()
+			right, _ := new(big.Float).SetInt(rightVal).Float64()
+			return &Float{Value: math.Pow(left, right)}
+		}
+		if leftVal.CmpAbs(big.NewInt(1)) <= 0 {
+			// 0, 1 and -1 never grow, whatever the exponent
+			if leftVal.Sign() < 0 && rightVal.Bit(0) == 0 {
+				return &Integer{Value: 1}
+			}
+			if rightVal.Sign() == 0 {
+				return &Integer{Value: 1}
+			}
+			return NewBigInteger(leftVal)
+		}
+		if !rightVal.IsInt64() || int64(leftVal.BitLen()-1)*rightVal.Int64() > maxIntegerBits {
+			return NewError("integer too large")
+		}
+		return NewBigInteger(new(big.Int).Exp(leftVal, rightVal, nil))
+	case "&":
+		return NewBigInteger(new(big.Int).And(leftVal, rightVal))
+	case "|":
+		return NewBigInteger(new(big.Int).Or(leftVal, rightVal))
+	case "^":
+		return NewBigInteger(new(big.Int).Xor(leftVal, rightVal))
+	case "<<":
+		if rightVal.Sign() < 0 {
+			return NewError("negative shift count: %s", rightVal)
+		}
+		if leftVal.Sign() == 0 {
+			return &Integer{Value: 0}
+		}
+		if !rightVal.IsInt64() || int64(leftVal.BitLen())+rightVal.Int64() > maxIntegerBits {
+			return NewError("integer too large")
+		}
+		return NewBigInteger(new(big.Int).Lsh(leftVal, uint(rightVal.Int64())))
+	case ">>":
+		if rightVal.Sign() < 0 {
+			return NewError("negative shift count: %s", rightVal)
+		}
+		if !rightVal.IsInt64() || rightVal.Int64() > int64(leftVal.BitLen()) {
+			// everything is shifted out, only the sign remains
+			if leftVal.Sign() < 0 {
+				return &Integer{Value: -1}
+			}
+			return &Integer{Value: 0}
+		}
+		// Rsh rounds towards negative infinity like the shift of ints
+		return NewBigInteger(new(big.Int).Rsh(leftVal, uint(rightVal.Int64())))
+	case "==":
+		return BoolObject(leftVal.Cmp(rightVal) == 0)
+	case "!=":
+		return BoolObject(leftVal.Cmp(rightVal) != 0)
+	case ">":
+		return BoolObject(leftVal.Cmp(rightVal) > 0)
+	case ">=":
+		return BoolObject(leftVal.Cmp(rightVal) >= 0)
+	case "<":
+		return BoolObject(leftVal.Cmp(rightVal) < 0)
+	case "<=":
+		return BoolObject(leftVal.Cmp(rightVal) <= 0)
+	default:
+		return NewError("unknown operator: %v%v%v", INTEGER_OBJ, operator, INTEGER_OBJ)
+	}
+}
+
+// floatInfixOperator is used as soon as one of the operands is a float, the
+// integer operand being promoted to a float beforehand
+func floatInfixOperator(operator string, leftVal, rightVal float64) Object {
+	switch operator {
+	case "+":
+		return &Float{Value: leftVal + rightVal}
+	case "-":
+		return &Float{Value: leftVal - rightVal}
+	case "*":
+		return &Float{Value: leftVal * rightVal}
+	case "/":
+		return &Float{Value: leftVal / rightVal}
+	case "%":
+		return &Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &Float{Value: math.Pow(leftVal, rightVal)}
+	case "==":
+		return BoolObject(leftVal == rightVal)
+	case "!=":
+		return BoolObject(leftVal != rightVal)
+	case ">":
+		return BoolObject(leftVal > rightVal)
+	case ">=":
+		return BoolObject(leftVal >= rightVal)
+	case "<":
+		return BoolObject(leftVal < rightVal)
+	case "<=":
+		return BoolObject(leftVal <= rightVal)
+	default:
+		return NewError("unknown operator: %v%v%v", FLOAT_OBJ, operator, FLOAT_OBJ)
+	}
+}
+
+func isNumber(obj Object) bool {
+	return obj.Type() == INTEGER_OBJ || obj.Type() == FLOAT_OBJ
+}
+
+func toFloat(obj Object) float64 {
+	switch obj := obj.(type) {
+	case *Integer:
+		if obj.Big != nil {
+			f, _ := new(big.Float).SetInt(obj.Big).Float64()
+			return f
+		}
+		return float64(obj.Value)
+	case *Float:
+		return obj.Value
+	}
+	return 0
+}
+
+func stringInfixOperator(operator string, left, right Object) Object {
+	leftVal := left.(*String).Value
+	rightVal := right.(*String).Value
+	switch operator {
+	case "+":
+		return &String{Value: leftVal + rightVal}
+	case "==":
+		return BoolObject(leftVal == rightVal)
+	case "!=":
+		return BoolObject(leftVal != rightVal)
+	case ">":
+		return BoolObject(leftVal > rightVal)
+	case ">=":
+		return BoolObject(leftVal >= rightVal)
+	case "<":
+		return BoolObject(leftVal < rightVal)
+	case "<=":
+		return BoolObject(leftVal <= rightVal)
+	default:
+		return NewError("unknown operator: %v%v%v", left.Type(), operator, right.Type())
+	}
+}
+
+// PrefixOperator computes -right and ~right, ! depends on the truthiness rule
+// and is left to the callers
+func PrefixOperator(operator string, right Object) Object {
+	switch operator {
+	case "-":
+		return negate(right)
+	case "~":
+		return bitNot(right)
+	default:
+		return NewError("unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+func negate(right Object) Object {
+	switch right := right.(type) {
+	case *Integer:
+		if right.Big != nil || right.Value == math.MinInt {
+			return NewBigInteger(new(big.Int).Neg(right.BigValue()))
+		}
+		return &Integer{Value: -right.Value}
+	case *Float:
+		return &Float{Value: -right.Value}
+	default:
+		return NewError("unknown operator: -%v", right.Type())
+	}
+}
+
+func bitNot(right Object) Object {
+	integer, ok := right.(*Integer)
+	if !ok {
+		return NewError("unknown operator: ~%v", right.Type())
+	}
+	if integer.Big != nil {
+		return NewBigInteger(new(big.Int).Not(integer.Big))
+	}
+	return &Integer{Value: ^integer.Value}
+}
+
+// Index gives left[index] for arrays, strings and hashes, a missing hash key gives null
+func Index(left, index Object) Object {
+	switch {
+	case left.Type() == ARRAY_OBJ && index.Type() == INTEGER_OBJ:
+		elements := left.(*Array).Elements
+		i, err := checkIndex(index.(*Integer), len(elements))
+		if err != nil {
+			return err
+		}
+		return elements[i]
+	case left.Type() == STRING_OBJ && index.Type() == INTEGER_OBJ:
+		chars := []rune(left.(*String).Value)
+		i, err := checkIndex(index.(*Integer), len(chars))
+		if err != nil {
+			return err
+		}
+		return &String{Value: string(chars[i])}
+	case left.Type() == RANGE_OBJ && index.Type() == INTEGER_OBJ:
+		r, i := left.(*Range), index.(*Integer)
+		if n, ok := r.At(i.Value); ok && i.Big == nil {
+			return &Integer{Value: n}
+		}
+		if i.BigValue().Sign() < 0 {
+			return NewError("negative index: %s", i.BigValue())
+		}
+		return NewError("index out of range: %s with length %s", i.BigValue(), r.Len().BigValue())
+	case left.Type() == HASH_OBJ:
+		key, ok := index.(Hashable)
+		if !ok {
+			return NewError("unusable as hash key: %s", index.Type())
+		}
+		value, ok := left.(*Hash).Get(key)
+		if !ok {
+			return NULL
+		}
+		return value
+	case left.Type() == ARRAY_OBJ || left.Type() == STRING_OBJ || left.Type() == RANGE_OBJ:
+		return NewError("index must be an INTEGER, got %s", index.Type())
+	default:
+		return NewError("index operator not supported: %s", left.Type())
+	}
+}
+
+// Member gives left.name, the global name of the module left
+func Member(left Object, name string) Object {
+	mod, ok := left.(*Module)
+	if !ok {
+		return NewError("not a module: %s", left.Type())
+	}
+	val, ok := mod.Get(name)
+	if !ok {
+		return NewError("module %s has no member %s", mod.Name, name)
+	}
+	return val
+}
+
+// Contains is the in operator: whether element is an element of an array or of
+// a range, a substring of a string or a key of a hash
+func Contains(collection, element Object) Object {
+	switch collection := collection.(type) {
+	case *Array:
+		for _, e := range collection.Elements {
+			if InfixOperator("==", e, element) == TRUE {
+				return TRUE
+			}
+		}
+		return FALSE
+	case *Range:
+		n, ok := element.(*Integer)
+		return BoolObject(ok && n.Big == nil && collection.Contains(n.Value))
+	case *String:
+		str, ok := element.(*String)
+		if !ok {
+			return NewError("type mismatch: %s in %s", element.Type(), collection.Type())
+		}
+		return BoolObject(strings.Contains(collection.Value, str.Value))
+	case *Hash:
+		key, ok := element.(Hashable)
+		if !ok {
+			return NewError("unusable as hash key: %s", element.Type())
+		}
+		_, ok = collection.Get(key)
+		return BoolObject(ok)
+	default:
+		return NewError("unknown operator: %s in %s", element.Type(), collection.Type())
+	}
+}
+
+// Iterate gives an iterator over the elements of obj: the indexes and elements
+// of an array or of a range, the indexes and characters of a string, the keys
+// and values of a hash in insertion order and, for an integer n, the integers
+// from 0 to n-1
+func Iterate(obj Object) (*Iterator, *Error) {
+	i := 0
+	switch obj := obj.(type) {
+	case *Range:
+		done, n := obj.empty, obj.Start
+		return &Iterator{next: func() (Object, Object, bool) {
+			if done {
+				return nil, nil, false
+			}
+			key, value := &Integer{Value: i}, &Integer{Value: n}
+			// stepping past the last element could overflow
+			if n == obj.last {
+				done = true
+			} else {
+				n += obj.Step
+			}
+			i++
+			return key, value, true
+		}}, nil
+	case *Array:
+		return &Iterator{next: func() (Object, Object, bool) {
+			if i >= len(obj.Elements) {
+				return nil, nil, false
+			}
+			i++
+			return &Integer{Value: i - 1}, obj.Elements[i-1], true
+		}}, nil
+	case *String:
+		chars := []rune(obj.Value)
+		return &Iterator{next: func() (Object, Object, bool) {
+			if i >= len(chars) {
+				return nil, nil, false
+			}
+			i++
+			return &Integer{Value: i - 1}, &String{Value: string(chars[i-1])}, true
+		}}, nil
+	case *Hash:
+		keys := obj.Keys
+		return &Iterator{keyed: true, next: func() (Object, Object, bool) {
+			if i >= len(keys) {
+				return nil, nil, false
+			}
+			i++
+			pair := obj.Pairs[keys[i-1]]
+			return pair.Key, pair.Value, true
+		}}, nil
+	case *Integer:
+		if obj.Big != nil {
+			return nil, NewError("range bound too large: %s", obj.Big)
+		}
+		return &Iterator{next: func() (Object, Object, bool) {
+			if i >= obj.Value {
+				return nil, nil, false
+			}
+			i++
+			return &Integer{Value: i - 1}, &Integer{Value: i - 1}, true
+		}}, nil
+	default:
+		return nil, NewError("not iterable: %s", obj.Type())
+	}
+}
+
+// Slice gives left[start:end] for arrays and strings, start and end are nil
+// when they are omitted
+func Slice(left, start, end Object) Object {
+	var length int
+	switch left := left.(type) {
+	case *Array:
+		length = len(left.Elements)
+	case *String:
+		length = len([]rune(left.Value))
+	default:
+		return NewError("slice operator not supported: %s", left.Type())
+	}
+
+	from, err := sliceBound(start, 0)
+	if err != nil {
+		return err
+	}
+	to, err := sliceBound(end, length)
+	if err != nil {
+		return err
+	}
+
+	if from < 0 || to > length || from > to {
+		return NewError("slice bounds out of range [%d:%d] with length %d", from, to, length)
+	}
+
+	switch left := left.(type) {
+	case *Array:
+		elements := make([]Object, to-from)
+		copy(elements, left.Elements[from:to])
+		return &Array{Elements: elements}
+	default:
+		return &String{Value: string([]rune(left.(*String).Value)[from:to])}
+	}
+}
+
+// sliceBound checks one of the bounds of a slice, def being used when it's omitted
+func sliceBound(bound Object, def int) (int, Object) {
+	if bound == nil {
+		return def, nil
+	}
+	integer, ok := bound.(*Integer)
+	if !ok {
+		return 0, NewError("slice bounds must be INTEGER, got %s", bound.Type())
+	}
+	if integer.Big != nil {
+		return 0, NewError("slice bound out of range: %s", integer.Big)
+	}
+	return integer.Value, nil
+}
+
+func checkIndex(index *Integer, length int) (int, Object) {
+	if index.Big != nil {
+		if index.Big.Sign() < 0 {
+			return 0, NewError("negative index: %s", index.Big)
+		}
+		return 0, NewError("index out of range: %s with length %d", index.Big, length)
+	}
+
+	i := index.Value
+	if i < 0 {
+		return 0, NewError("negative index: %d", i)
+	}
+	if i >= length {
+		return 0, NewError("index out of range: %d with length %d", i, length)
+	}
+	return i, nil
+}
+
+// ThrownError turns the value of a throw statement into an error. A caught error
+// can be thrown again as it is, its message is kept
+func ThrownError(val Object) *Error {
+	if hash, ok := val.(*Hash); ok {
+		if message, ok := hash.Get(&String{Value: "message"}); ok {
+			val = message
+		}
+	}
+	if str, ok := val.(*String); ok {
+		return NewError("%s", str.Value)
+	}
+	return NewError("%s", strings.TrimSuffix(val.Inspect(), "\n"))
+}
+
+// ErrorToHash gives the value a catch block receives for err: a hash with its
+// message, position and stack of calls, innermost first
+func ErrorToHash(err *Error) *Hash {
+	stack := make([]Object, 0, len(err.Stack))
+	for _, frame := range err.Stack {
+		var function Object = NULL
+		if frame.Function != "" {
+			function = &String{Value: frame.Function}
+		}
+		entry := NewHash()
+		setField(entry, "function", function)
+		setField(entry, "file", &String{Value: frame.File})
+		setField(entry, "line", &Integer{Value: frame.Line})
+		setField(entry, "column", &Integer{Value: frame.Column})
+		stack = append(stack, entry)
+	}
+
+	hash := NewHash()
+	setField(hash, "message", &String{Value: err.Message})
+	setField(hash, "file", &String{Value: err.File})
+	setField(hash, "line", &Integer{Value: err.Line})
+	setField(hash, "column", &Integer{Value: err.Column})
+	setField(hash, "stack", &Array{Elements: stack})
+	return hash
+}
+
+func setField(hash *Hash, key string, value Object) {
+	hash.Set(&String{Value: key}, value)
+}
+
+// BoolObject gives the Boolean of b
+func BoolObject(b bool) *Boolean {
+	if b {
+		return TRUE
+	}
+	return FALSE
+}
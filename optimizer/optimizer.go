@@ -0,0 +1,233 @@
+package optimizer
+
+import (
+	"strings"
+
+	"github.com/tysufa/qfa/ast"
+	"github.com/tysufa/qfa/object"
+	"github.com/tysufa/qfa/token"
+)
+
+// Optimize rewrites program in place so that it does less work when run and
+// gives the same results:
+//   - the operators whose operands are integer or boolean literals are computed
+//     once and replaced by their result, unless they raise an error, like 1/0,
+//     which is left to be reported at runtime
+//   - the branch of an if that can't be taken because its condition is a
+//     literal is removed
+//   - the statements following a return in the same block are removed
+func Optimize(program *ast.Program) {
+	program.Statements = optimizeStatements(program.Statements)
+}
+
+func optimizeStatements(statements []ast.Statement) []ast.Statement {
+	for i, stmt := range statements {
+		optimizeStatement(stmt)
+		if _, ok := stmt.(*ast.ReturnStatement); ok {
+			return statements[:i+1]
+		}
+	}
+	return statements
+}
+
+func optimizeBlock(block *ast.BlockStatement) {
+	if block != nil {
+		block.Statements = optimizeStatements(block.Statements)
+	}
+}
+
+func optimizeStatement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		stmt.Value = optimizeExpression(stmt.Value)
+	case *ast.AssignementStatement:
+		stmt.Value = optimizeExpression(stmt.Value)
+	case *ast.ExpressionStatement:
+		stmt.Expression = optimizeExpression(stmt.Expression)
+	case *ast.ReturnStatement:
+		stmt.Value = optimizeExpression(stmt.Value)
+	case *ast.ThrowStatement:
+		stmt.Value = optimizeExpression(stmt.Value)
+	case *ast.PrintStatement:
+		optimizeExpressions(stmt.Arguments)
+	case *ast.WhileStatement:
+		stmt.Condition = optimizeExpression(stmt.Condition)
+		optimizeBlock(stmt.Instructions)
+	case *ast.ForStatement:
+		optimizeStatement(stmt.Init)
+		stmt.Condition = optimizeExpression(stmt.Condition)
+		optimizeStatement(stmt.Update)
+		optimizeBlock(stmt.Body)
+	case *ast.ForInStatement:
+		stmt.Iterable = optimizeExpression(stmt.Iterable)
+		optimizeBlock(stmt.Body)
+	case *ast.TryStatement:
+		optimizeBlock(stmt.Body)
+		optimizeBlock(stmt.Catch)
+		optimizeBlock(stmt.Finally)
+	}
+}
+
+func optimizeExpressions(exprs []ast.Expression) {
+	for i, expr := range exprs {
+		exprs[i] = optimizeExpression(expr)
+	}
+}
+
+// optimizeExpression optimizes the children of expr and returns what replaces it
+func optimizeExpression(expr ast.Expression) ast.Expression {
+	switch expr := expr.(type) {
+	case *ast.InfixExpression:
+		expr.Left = optimizeExpression(expr.Left)
+		expr.Right = optimizeExpression(expr.Right)
+		return foldInfix(expr)
+	case *ast.PrefixExpression:
+		expr.Right = optimizeExpression(expr.Right)
+		return foldPrefix(expr)
+	case *ast.IfExpression:
+		expr.Condition = optimizeExpression(expr.Condition)
+		optimizeBlock(expr.Consequences)
+		optimizeBlock(expr.ElseConsequences)
+		removeDeadBranch(expr)
+	case *ast.FunctionLiteral:
+		optimizeBlock(&expr.Body)
+	case *ast.CallExpression:
+		expr.Function = optimizeExpression(expr.Function)
+		optimizeExpressions(expr.Arguments)
+	case *ast.ArrayLiteral:
+		optimizeExpressions(expr.Elements)
+	case *ast.HashLiteral:
+		optimizeExpressions(expr.Keys)
+		optimizeExpressions(expr.Values)
+	case *ast.IndexExpression:
+		expr.Left = optimizeExpression(expr.Left)
+		expr.Index = optimizeExpression(expr.Index)
+	case *ast.MemberExpression:
+		expr.Left = optimizeExpression(expr.Left)
+	case *ast.RangeExpression:
+		expr.Start = optimizeExpression(expr.Start)
+		expr.End = optimizeExpression(expr.End)
+		if expr.Step != nil {
+			expr.Step = optimizeExpression(expr.Step)
+		}
+	case *ast.SliceExpression:
+		expr.Left = optimizeExpression(expr.Left)
+		if expr.Start != nil {
+			expr.Start = optimizeExpression(expr.Start)
+		}
+		if expr.End != nil {
+			expr.End = optimizeExpression(expr.End)
+		}
+	}
+	return expr
+}
+
+// removeDeadBranch keeps only the branch taken when the condition is a boolean
+// literal, which becomes if (true) { taken } else {}
+func removeDeadBranch(expr *ast.IfExpression) {
+	condition, ok := expr.Condition.(*ast.Boolean)
+	if !ok {
+		return
+	}
+
+	if !condition.Value {
+		// without else the if gives null, it has to stay
+		if expr.ElseConsequences == nil {
+			expr.Consequences = &ast.BlockStatement{Token: expr.Consequences.Token}
+			return
+		}
+		expr.Consequences = expr.ElseConsequences
+		expr.Condition = newBoolean(condition.Token, true)
+	}
+	expr.ElseConsequences = &ast.BlockStatement{Token: expr.Consequences.Token}
+}
+
+func foldInfix(expr *ast.InfixExpression) ast.Expression {
+	left, ok := literalValue(expr.Left)
+	if !ok {
+		return expr
+	}
+	right, ok := literalValue(expr.Right)
+	if !ok {
+		return expr
+	}
+
+	// both operands are known so there is nothing to short-circuit, and the
+	// truthiness rules agree on booleans
+	if expr.Operator == "&&" || expr.Operator == "||" {
+		leftBool, ok := left.(*object.Boolean)
+		if !ok {
+			return expr
+		}
+		rightBool, ok := right.(*object.Boolean)
+		if !ok {
+			return expr
+		}
+		if expr.Operator == "&&" {
+			return newBoolean(expr.Token, leftBool.Value && rightBool.Value)
+		}
+		return newBoolean(expr.Token, leftBool.Value || rightBool.Value)
+	}
+
+	return literalOf(object.InfixOperator(expr.Operator, left, right), expr)
+}
+
+func foldPrefix(expr *ast.PrefixExpression) ast.Expression {
+	right, ok := literalValue(expr.Right)
+	if !ok {
+		return expr
+	}
+
+	if expr.Operator == "!" {
+		// !x only means the same thing in both truthiness rules for booleans
+		if right, ok := right.(*object.Boolean); ok {
+			return newBoolean(expr.Token, !right.Value)
+		}
+		return expr
+	}
+
+	return literalOf(object.PrefixOperator(expr.Operator, right), expr)
+}
+
+// literalValue gives the value of an integer or boolean literal
+func literalValue(expr ast.Expression) (object.Object, bool) {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: expr.Value, Big: expr.Big}, true
+	case *ast.Boolean:
+		// the operators compare booleans by identity
+		if expr.Value {
+			return object.TRUE, true
+		}
+		return object.FALSE, true
+	default:
+		return nil, false
+	}
+}
+
+// literalOf gives the literal of value, which replaces expr, or expr itself if
+// value is an error or can't be written as an integer or boolean literal
+func literalOf(value object.Object, expr ast.Expression) ast.Expression {
+	switch value := value.(type) {
+	case *object.Integer:
+		tok := expr.GetToken()
+		tok.Type = token.INT
+		tok.Value = strings.TrimSuffix(value.Inspect(), "\n")
+		return &ast.IntegerLiteral{Token: tok, Value: value.Value, Big: value.Big}
+	case *object.Boolean:
+		return newBoolean(expr.GetToken(), value.Value)
+	default:
+		return expr
+	}
+}
+
+// newBoolean creates a boolean literal at the position of tok
+func newBoolean(tok token.Token, value bool) *ast.Boolean {
+	tok.Type = token.FALSE
+	tok.Value = "false"
+	if value {
+		tok.Type = token.TRUE
+		tok.Value = "true"
+	}
+	return &ast.Boolean{Token: tok, Value: value}
+}
@@ -0,0 +1,136 @@
+// external tests: the evaluator they compare with loads modules through the optimizer
+package optimizer_test
+
+import (
+	"testing"
+
+	"github.com/tysufa/qfa/ast"
+	"github.com/tysufa/qfa/evaluator"
+	"github.com/tysufa/qfa/lexer"
+	"github.com/tysufa/qfa/object"
+	"github.com/tysufa/qfa/optimizer"
+	"github.com/tysufa/qfa/parser"
+)
+
+func TestConstantFolding(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2 * 60 * 60", "7200"},
+		{"1 + 2 * x", "(1+(2*x))"},
+		{"x * 2 * 3", "((x*2)*3)"},
+		{"-(1 + 2)", "-3"},
+		{"~0", "-1"},
+		{"!true", "false"},
+		{"!(1 < 2)", "false"},
+		{"1 == 1 && 2 > 3", "false"},
+		{"true || false", "true"},
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"2 ** 3 ** 2", "512"},
+		{"let a = [1 + 1, {2 * 2: 3 - 3}[4]];", "let a = [2, ({4: 0}[4])];"},
+		{"fn(x) { x + (1 << 4) }", "fn(x)(x+16)"},
+		{"f(10 % 3)", "f(1)"},
+		// errors are left for the runtime to report
+		{"1 / 0", "(1/0)"},
+		{"1 % (2 - 2)", "(1%0)"},
+		{"1 << -1", "(1<<-1)"},
+		{"5 + true", "(5+true)"},
+		{"-true", "(-true)"},
+		// results that aren't integers or booleans
+		{"2 ** -1", "(2**-1)"},
+		{"1.5 + 1", "(1.5+1)"},
+		// ! and the logical operators depend on the truthiness rule for integers
+		{"!0", "(!0)"},
+		{"1 && true", "(1&&true)"},
+	}
+
+	for _, tt := range tests {
+		program := testOptimize(tt.input)
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestFoldedPosition(t *testing.T) {
+	program := testOptimize("let a =\n  1 + 2;")
+
+	literal, ok := program.Statements[0].(*ast.LetStatement).Value.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("value is not an IntegerLiteral. got=%T", program.Statements[0].(*ast.LetStatement).Value)
+	}
+	if literal.Value != 3 || literal.Token.Line != 2 || literal.Token.Column != 5 {
+		t.Errorf("wrong literal. got=%d at %d:%d", literal.Value, literal.Token.Line, literal.Token.Column)
+	}
+}
+
+func TestDeadCodeRemoval(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (true) { 1 } else { 2 }", "iftrue{1}else{}"},
+		{"if (false) { 1 } else { 2 }", "iftrue{2}else{}"},
+		{"if (false) { 1 }", "iftrue{}else{}"},
+		{"if (1 > 2) { 1 } else { 2 }", "iftrue{2}else{}"},
+		{"if (x) { 1 } else { 2 }", "ifx{1}else{2}"},
+		// integers are true or an error depending on the truthiness rule
+		{"if (1) { 1 } else { 2 }", "if1{1}else{2}"},
+		{"fn() { return 1; 2; 3 }", "fn()return 1"},
+		{"fn() { if (x) { return 1; print(2); } 3 }", "fn()ifx{return 1}else{}3"},
+		{"while (x) { if (false) { return 1; } else { break; } }", "whilex{iftrue{break;}else{}}"},
+		{"try { return 1; x; } catch (e) { return 2; y; } finally { return 3; z; }", "try{return 1}catch(e){return 2}finally{return 3}"},
+		{"1; return 2; 3;", "1return 2"},
+	}
+
+	for _, tt := range tests {
+		program := testOptimize(tt.input)
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestSameResults(t *testing.T) {
+	tests := []string{
+		"let a = 2 * 60 * 60; a;",
+		"if (false) { 1 }",
+		"if (true) { 1 } else { 2 }",
+		"let f = fn(x) { if (1 < 2) { return x; 5; } 3 }; f(4);",
+		"let f = fn() { if (false) { 1 } }; f();",
+		"1 / 0",
+		"let x = 3;\nlet y = x + (1 % 0);",
+		"try { 1 / (2 - 2); } catch (e) { e[\"message\"]; }",
+		"[1 + 1, -(2 ** 70), !false]",
+		"let f = fn(n) { if (n == 0) { return 0; } return f(n - (3 - 2)); }; f(100);",
+	}
+
+	for _, input := range tests {
+		expected := evaluate(testParse(input))
+		got := evaluate(testOptimize(input))
+
+		if got != expected {
+			t.Errorf("optimizing %q changed its result. expected=%q, got=%q", input, expected, got)
+		}
+	}
+}
+
+func evaluate(program *ast.Program) string {
+	results := evaluator.EvaluateProgram(program.Statements, object.NewEnvironment())
+	if len(results) == 0 || results[len(results)-1] == nil {
+		return "nil"
+	}
+	return results[len(results)-1].Inspect()
+}
+
+func testOptimize(input string) *ast.Program {
+	program := testParse(input)
+	optimizer.Optimize(program)
+	return program
+}
+
+func testParse(input string) *ast.Program {
+	program := parser.New(lexer.New(input)).GetStatements()
+	return &program
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"math/big"
 	"strconv"
 
 	"github.com/tysufa/qfa/ast"
@@ -17,11 +18,19 @@ type (
 const (
 	_ = iota
 	LOWEST
+	LOGICAL_OR
+	LOGICAL_AND
 	EQUAL
 	LESSGREATER
+	RANGE
+	BIT_OR
+	BIT_XOR
+	BIT_AND
+	SHIFT
 	SUM
 	PRODUCT
-	PREFIX
+	PREFIX // below POWER: -2 ** 2 is -(2 ** 2)
+	POWER
 	CALL
 )
 
@@ -32,12 +41,13 @@ type Parser struct {
 	Errors         []string
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+	loopDepth      int // number of loops enclosing the current statement
 }
 
 func New(l lexer.Lexer) *Parser {
-	cur := l.GetToken()
-	peek := l.GetToken()
-	p := &Parser{lex: l, curToken: cur, peekToken: peek}
+	p := &Parser{lex: l}
+	p.nextToken()
+	p.nextToken()
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 
@@ -45,11 +55,16 @@ func New(l lexer.Lexer) *Parser {
 	p.prefixParseFns[token.TRUE] = p.parseBool
 	p.prefixParseFns[token.FALSE] = p.parseBool
 	p.prefixParseFns[token.INT] = p.parseIntegerLiteral
+	p.prefixParseFns[token.FLOAT] = p.parseFloatLiteral
+	p.prefixParseFns[token.STRING] = p.parseStringLiteral
 	p.prefixParseFns[token.MINUS] = p.parsePrefixExpression
 	p.prefixParseFns[token.BANG] = p.parsePrefixExpression
+	p.prefixParseFns[token.BIT_NOT] = p.parsePrefixExpression
 	p.prefixParseFns[token.LPAR] = p.parseGroupExpression
 	p.prefixParseFns[token.IF] = p.parseIfExpression
 	p.prefixParseFns[token.FN] = p.parseFunctionLiteral
+	p.prefixParseFns[token.LBRACKET] = p.parseArrayLiteral
+	p.prefixParseFns[token.LBR] = p.parseHashLiteral
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 
@@ -57,26 +72,41 @@ func New(l lexer.Lexer) *Parser {
 	p.infixParseFns[token.MINUS] = p.parseInfixExpression
 	p.infixParseFns[token.STAR] = p.parseInfixExpression
 	p.infixParseFns[token.SLASH] = p.parseInfixExpression
+	p.infixParseFns[token.PERCENT] = p.parseInfixExpression
+	p.infixParseFns[token.POWER] = p.parseInfixExpression
+	p.infixParseFns[token.BIT_AND] = p.parseInfixExpression
+	p.infixParseFns[token.BIT_OR] = p.parseInfixExpression
+	p.infixParseFns[token.BIT_XOR] = p.parseInfixExpression
+	p.infixParseFns[token.LSHIFT] = p.parseInfixExpression
+	p.infixParseFns[token.RSHIFT] = p.parseInfixExpression
 	p.infixParseFns[token.EQEQ] = p.parseInfixExpression
 	p.infixParseFns[token.NEQ] = p.parseInfixExpression
 	p.infixParseFns[token.LT] = p.parseInfixExpression
 	p.infixParseFns[token.GT] = p.parseInfixExpression
 	p.infixParseFns[token.GEQT] = p.parseInfixExpression
 	p.infixParseFns[token.LEQT] = p.parseInfixExpression
+	p.infixParseFns[token.AND] = p.parseInfixExpression
+	p.infixParseFns[token.OR] = p.parseInfixExpression
+	p.infixParseFns[token.IN] = p.parseInfixExpression
+	p.infixParseFns[token.DOTDOT] = p.parseRangeExpression
+	p.infixParseFns[token.DOTDOTEQ] = p.parseRangeExpression
 	p.infixParseFns[token.LPAR] = p.parseCallExpression
+	p.infixParseFns[token.LBRACKET] = p.parseIndexExpression
+	p.infixParseFns[token.DOT] = p.parseMemberExpression
 
 	return p
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
-	exp.Arguments = p.parseCallArguments()
+	exp.Arguments = p.parseExpressionList(token.RPAR)
 	return exp
 }
 
-func (p *Parser) parseCallArguments() []ast.Expression {
+// parseExpressionList parses comma separated expressions up to the end token
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	args := []ast.Expression{}
-	if p.peekToken.Type == token.RPAR {
+	if p.peekToken.Type == end {
 		p.nextToken()
 		return args
 	}
@@ -87,12 +117,87 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 		p.nextToken()
 		args = append(args, p.parseExpression(LOWEST))
 	}
-	if !p.expectPeek(token.RPAR) {
+	if !p.expectPeek(end) {
 		return nil
 	}
 	return args
 }
 
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	return array
+}
+
+// parseHashLiteral parses {key: value, ...}. Blocks are only expected after
+// if, else, while and fn and are parsed by parseBlockStatement, so a brace
+// met by parseExpression always starts a hash literal
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken}
+
+	for p.peekToken.Type != token.RBR {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+
+		hash.Keys = append(hash.Keys, key)
+		hash.Values = append(hash.Values, value)
+
+		if p.peekToken.Type != token.RBR && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBR) {
+		return nil
+	}
+
+	return hash
+}
+
+// parseIndexExpression parses both xs[i] and the slice forms xs[i:j], xs[:j], xs[i:] and xs[:]
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	tok := p.curToken
+	var start ast.Expression
+
+	if p.peekToken.Type != token.COLON {
+		p.nextToken()
+		start = p.parseExpression(LOWEST)
+		if p.peekToken.Type != token.COLON {
+			if !p.expectPeek(token.RBRACKET) {
+				return nil
+			}
+			return &ast.IndexExpression{Token: tok, Left: left, Index: start}
+		}
+	}
+
+	slice := &ast.SliceExpression{Token: tok, Left: left, Start: start}
+	p.nextToken() // on the colon
+	if p.peekToken.Type != token.RBRACKET {
+		p.nextToken()
+		slice.End = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	return slice
+}
+
+func (p *Parser) parseMemberExpression(left ast.Expression) ast.Expression {
+	exp := &ast.MemberExpression{Token: p.curToken, Left: left}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	exp.Member = &ast.Identifier{Token: p.curToken, Value: p.curToken.Value}
+	return exp
+}
+
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	fn := &ast.FunctionLiteral{Token: p.curToken}
 
@@ -105,7 +210,11 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
+	// break and continue can't cross a function boundary
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	fn.Body = *p.parseBlockStatement()
+	p.loopDepth = loopDepth
 
 	return fn
 }
@@ -140,6 +249,10 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.lex.GetToken()
+	// statements are delimited by semicolons, new lines carry no meaning
+	for p.peekToken.Type == token.NL {
+		p.peekToken = p.lex.GetToken()
+	}
 }
 
 func (p *Parser) parseStatement() ast.Statement {
@@ -150,14 +263,28 @@ func (p *Parser) parseStatement() ast.Statement {
 	case token.RETURN:
 		stmt = p.parseReturn()
 	case token.WHILE:
-    stmt = p.parseWhile()
-  case token.IDENT:
-    if p.peekToken.Type == token.EQ{
-      stmt = p.parseAssignement()
-    } else{
-      stmt = p.parseExpressionStatement()
-    }
-    
+		stmt = p.parseWhile()
+	case token.FOR:
+		stmt = p.parseFor()
+	case token.PRINT:
+		stmt = p.parsePrint()
+	case token.BREAK:
+		stmt = p.parseBreak()
+	case token.CONTINUE:
+		stmt = p.parseContinue()
+	case token.TRY:
+		stmt = p.parseTry()
+	case token.THROW:
+		stmt = p.parseThrow()
+	case token.IMPORT:
+		stmt = p.parseImport()
+	case token.IDENT:
+		if p.peekToken.Type == token.EQ {
+			stmt = p.parseAssignement()
+		} else {
+			stmt = p.parseExpressionStatement()
+		}
+
 	default:
 		stmt = p.parseExpressionStatement()
 	}
@@ -176,32 +303,196 @@ func (p *Parser) GetStatements() ast.Program {
 		}
 		p.nextToken()
 	}
+
+	// errors found by the lexer come first as they are usually the cause of the parser ones
+	p.Errors = append(append([]string{}, p.lex.Errors...), p.Errors...)
+
 	return res
 }
 
-func (p *Parser) parseWhile() *ast.WhileStatement{
-  ws := &ast.WhileStatement{Token: p.curToken}
-  if !p.expectPeek(token.LPAR){
-    return nil
-  }
-  p.nextToken()
+func (p *Parser) parseWhile() *ast.WhileStatement {
+	ws := &ast.WhileStatement{Token: p.curToken}
+	if !p.expectPeek(token.LPAR) {
+		return nil
+	}
+	p.nextToken()
 
-  ws.Condition = p.parseExpression(LOWEST)
+	ws.Condition = p.parseExpression(LOWEST)
 
-  if !p.expectPeek(token.RPAR){
-    return nil
-  }
+	if !p.expectPeek(token.RPAR) {
+		return nil
+	}
 
-  if !p.expectPeek(token.LBR){
-    return nil
-  }
+	if !p.expectPeek(token.LBR) {
+		return nil
+	}
 
-  ws.Instructions = p.parseBlockStatement()
+	p.loopDepth++
+	ws.Instructions = p.parseBlockStatement()
+	p.loopDepth--
 
-  return ws
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+
+	return ws
+}
+
+// parseFor parses both for (init; condition; update) { } and
+// for (x in iterable) { }, told apart by the in after the first identifier
+func (p *Parser) parseFor() ast.Statement {
+	tok := p.curToken
+	if !p.expectPeek(token.LPAR) {
+		return nil
+	}
+	p.nextToken()
+	if p.curToken.Type == token.IDENT && (p.peekToken.Type == token.IN || p.peekToken.Type == token.COMMA) {
+		return p.parseForIn(tok)
+	}
+
+	fs := &ast.ForStatement{Token: tok}
+	if p.curToken.Type != token.SEMICOLON {
+		fs.Init = p.parseForClause()
+		if fs.Init == nil {
+			return nil
+		}
+		// the let and the assignment already consume the ';'
+		if p.curToken.Type != token.SEMICOLON && !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+
+	if p.peekToken.Type != token.SEMICOLON {
+		p.nextToken()
+		fs.Condition = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.SEMICOLON) {
+		return nil
+	}
+
+	if p.peekToken.Type != token.RPAR {
+		p.nextToken()
+		if p.curToken.Type == token.LET {
+			p.Errors = append(p.Errors, fmt.Sprintf("unexpected 'let' in the update of a for loop at line %v", p.curToken.Line))
+			return nil
+		}
+		fs.Update = p.parseForClause()
+	}
+	if !p.expectPeek(token.RPAR) {
+		return nil
+	}
+
+	fs.Body = p.parseLoopBody()
+	if fs.Body == nil {
+		return nil
+	}
+	return fs
+}
+
+// parseForClause parses the initialization or the update of a for loop: a let,
+// an assignment or an expression
+func (p *Parser) parseForClause() ast.Statement {
+	switch {
+	case p.curToken.Type == token.LET:
+		if let := p.parseLet(); let != nil {
+			return let
+		}
+		return nil
+	case p.curToken.Type == token.IDENT && p.peekToken.Type == token.EQ:
+		return p.parseAssignement()
+	default:
+		return p.parseExpressionStatement()
+	}
 }
 
-func (p *Parser) parseAssignement() *ast.AssignementStatement{
+func (p *Parser) parseForIn(tok token.Token) ast.Statement {
+	fs := &ast.ForInStatement{Token: tok}
+	fs.Variables = append(fs.Variables, &ast.Identifier{Token: p.curToken, Value: p.curToken.Value})
+	if p.peekToken.Type == token.COMMA {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		fs.Variables = append(fs.Variables, &ast.Identifier{Token: p.curToken, Value: p.curToken.Value})
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	fs.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAR) {
+		return nil
+	}
+
+	fs.Body = p.parseLoopBody()
+	if fs.Body == nil {
+		return nil
+	}
+	return fs
+}
+
+// parseLoopBody parses the block of a for loop, in which break and continue
+// are allowed
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	if !p.expectPeek(token.LBR) {
+		return nil
+	}
+
+	p.loopDepth++
+	body := p.parseBlockStatement()
+	p.loopDepth--
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+
+	return body
+}
+
+func (p *Parser) parsePrint() *ast.PrintStatement {
+	ps := &ast.PrintStatement{Token: p.curToken}
+	if !p.expectPeek(token.LPAR) {
+		return nil
+	}
+
+	ps.Arguments = p.parseExpressionList(token.RPAR)
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+
+	return ps
+}
+
+func (p *Parser) parseBreak() *ast.BreakStatement {
+	bs := &ast.BreakStatement{Token: p.curToken}
+	if p.loopDepth == 0 {
+		p.Errors = append(p.Errors, fmt.Sprintf("'break' outside of a loop at line %v", p.curToken.Line))
+	}
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+
+	return bs
+}
+
+func (p *Parser) parseContinue() *ast.ContinueStatement {
+	cs := &ast.ContinueStatement{Token: p.curToken}
+	if p.loopDepth == 0 {
+		p.Errors = append(p.Errors, fmt.Sprintf("'continue' outside of a loop at line %v", p.curToken.Line))
+	}
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+
+	return cs
+}
+
+func (p *Parser) parseAssignement() *ast.AssignementStatement {
 	ass := &ast.AssignementStatement{Token: p.curToken}
 
 	ass.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Value}
@@ -210,25 +501,39 @@ func (p *Parser) parseAssignement() *ast.AssignementStatement{
 
 	ass.Value = p.parseExpression(LOWEST)
 
-  if p.peekToken.Type == token.SEMICOLON{
-    p.nextToken()
-  }
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
 
 	return ass
 }
 
 var precedences = map[token.TokenType]int{
-	token.PLUS:  SUM,
-	token.MINUS: SUM,
-	token.STAR:  PRODUCT,
-	token.SLASH: PRODUCT,
-	token.GT:    LESSGREATER,
-	token.LT:    LESSGREATER,
-	token.LEQT:  LESSGREATER,
-	token.GEQT:  LESSGREATER,
-	token.EQEQ:  EQUAL,
-	token.NEQ:   EQUAL,
-	token.LPAR:  CALL,
+	token.PLUS:     SUM,
+	token.MINUS:    SUM,
+	token.STAR:     PRODUCT,
+	token.SLASH:    PRODUCT,
+	token.PERCENT:  PRODUCT,
+	token.POWER:    POWER,
+	token.BIT_OR:   BIT_OR,
+	token.BIT_XOR:  BIT_XOR,
+	token.BIT_AND:  BIT_AND,
+	token.LSHIFT:   SHIFT,
+	token.RSHIFT:   SHIFT,
+	token.GT:       LESSGREATER,
+	token.LT:       LESSGREATER,
+	token.LEQT:     LESSGREATER,
+	token.GEQT:     LESSGREATER,
+	token.IN:       LESSGREATER,
+	token.DOTDOT:   RANGE,
+	token.DOTDOTEQ: RANGE,
+	token.EQEQ:     EQUAL,
+	token.NEQ:      EQUAL,
+	token.AND:      LOGICAL_AND,
+	token.OR:       LOGICAL_OR,
+	token.LPAR:     CALL,
+	token.LBRACKET: CALL,
+	token.DOT:      CALL,
 }
 
 func (p *Parser) getPeekPrecedence() int {
@@ -267,23 +572,61 @@ func (p *Parser) parseIdent() ast.Expression {
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	val, err := strconv.Atoi(p.curToken.Value)
-	if err != nil {
+	if err == nil {
+		return &ast.IntegerLiteral{Token: p.curToken, Value: val}
+	}
+
+	// too large for an int, the literal is kept as a big integer
+	big, ok := new(big.Int).SetString(p.curToken.Value, 10)
+	if !ok {
 		err := fmt.Sprintf("could not convert %s to an integer", p.curToken.Value)
 		p.Errors = append(p.Errors, err)
 		return nil
-	} else {
-		return &ast.IntegerLiteral{Token: p.curToken, Value: val}
 	}
+	return &ast.IntegerLiteral{Token: p.curToken, Big: big}
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	val, err := strconv.ParseFloat(p.curToken.Value, 64)
+	if err != nil {
+		err := fmt.Sprintf("could not convert %s to a float", p.curToken.Value)
+		p.Errors = append(p.Errors, err)
+		return nil
+	}
+	return &ast.FloatLiteral{Token: p.curToken, Value: val}
+}
+
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Value}
 }
 
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	infix := &ast.InfixExpression{Token: p.curToken, Left: left, Operator: p.curToken.Value}
 	precedence := p.getPrecedence()
+	if p.curToken.Type == token.POWER {
+		// right associative: 2 ** 3 ** 2 is 2 ** (3 ** 2)
+		precedence--
+	}
 	p.nextToken()
 	infix.Right = p.parseExpression(precedence)
 	return infix
 }
 
+// parseRangeExpression parses start..end and start..=end, step being a keyword
+// only after a range so that it can still name a variable
+func (p *Parser) parseRangeExpression(start ast.Expression) ast.Expression {
+	r := &ast.RangeExpression{Token: p.curToken, Start: start, Inclusive: p.curToken.Type == token.DOTDOTEQ}
+	p.nextToken()
+	r.End = p.parseExpression(RANGE)
+
+	if p.peekToken.Type == token.IDENT && p.peekToken.Value == "step" {
+		p.nextToken()
+		p.nextToken()
+		r.Step = p.parseExpression(RANGE)
+	}
+	return r
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 
@@ -333,6 +676,89 @@ func (p *Parser) parseGroupExpression() ast.Expression {
 	return expr
 }
 
+func (p *Parser) parseThrow() *ast.ThrowStatement {
+	ts := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	ts.Value = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.SEMICOLON) {
+		return nil
+	}
+
+	return ts
+}
+
+// parseTry parses try { } catch (e) { } finally { }, either the catch or the
+// finally part can be left out but not both
+func (p *Parser) parseTry() *ast.TryStatement {
+	ts := &ast.TryStatement{Token: p.curToken}
+	if !p.expectPeek(token.LBR) {
+		return nil
+	}
+	ts.Body = p.parseBlockStatement()
+
+	if p.peekToken.Type == token.CATCH {
+		p.nextToken()
+		if !p.expectPeek(token.LPAR) {
+			return nil
+		}
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		ts.CatchParam = &ast.Identifier{Token: p.curToken, Value: p.curToken.Value}
+		if !p.expectPeek(token.RPAR) {
+			return nil
+		}
+		if !p.expectPeek(token.LBR) {
+			return nil
+		}
+		ts.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekToken.Type == token.FINALLY {
+		p.nextToken()
+		if !p.expectPeek(token.LBR) {
+			return nil
+		}
+		ts.Finally = p.parseBlockStatement()
+	}
+
+	if ts.Catch == nil && ts.Finally == nil {
+		p.Errors = append(p.Errors, fmt.Sprintf("expected 'catch' or 'finally' after the try block at line %v", p.curToken.Line))
+		return nil
+	}
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+
+	return ts
+}
+
+// parseImport parses import "path" as name;
+func (p *Parser) parseImport() *ast.ImportStatement {
+	is := &ast.ImportStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	is.Path = p.curToken.Value
+	if !p.expectPeek(token.AS) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	is.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Value}
+	if !p.expectPeek(token.SEMICOLON) {
+		return nil
+	}
+
+	return is
+}
+
 func (p *Parser) parseReturn() *ast.ReturnStatement {
 	ret := &ast.ReturnStatement{Token: p.curToken}
 
@@ -357,8 +783,12 @@ func (p *Parser) parseLet() *ast.LetStatement {
 	}
 	p.nextToken()
 
-  // TODO: take care of the case where it's an if expression with multiple outpus
+	// TODO: take care of the case where it's an if expression with multiple outpus
 	let.Value = p.parseExpression(LOWEST)
+	if fn, ok := let.Value.(*ast.FunctionLiteral); ok {
+		// named after the variable in the tracebacks
+		fn.Name = let.Name.Value
+	}
 
 	if !p.expectPeek(token.SEMICOLON) {
 		return nil
@@ -104,6 +104,36 @@ func TestFunctionLiteralParsing(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+func TestFunctionLiteralName(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedName string
+	}{
+		{"let add = fn(x, y) { x + y; };", "add"},
+		{"let apply = fn(f) { f(1) }(fn(x) { x });", ""},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.GetStatements()
+		testParserErrors(t, p)
+		testStatementsNumber(t, 1, program.Statements)
+
+		let, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T", program.Statements[0])
+		}
+		name := ""
+		if function, ok := let.Value.(*ast.FunctionLiteral); ok {
+			name = function.Name
+		}
+		if name != tt.expectedName {
+			t.Errorf("wrong function name for %q, expected %q, got %q", tt.input, tt.expectedName, name)
+		}
+	}
+}
+
 func TestPriorityOperations(t *testing.T) {
 	tests := []struct {
 		input          string
@@ -114,6 +144,18 @@ func TestPriorityOperations(t *testing.T) {
 		{"1 * 2 + 3 / 4 - 5", "(((1*2)+(3/4))-5)"},
 		{"-1 * 2 + !3", "(((-1)*2)+(!3))"},
 		{"-a*b", "((-a)*b)"},
+		{"a % b + c", "((a%b)+c)"},
+		{"2 ** 3 ** 2", "(2**(3**2))"},
+		{"-2 ** 2", "(-(2**2))"},
+		{"2 ** -1", "(2**(-1))"},
+		{"-2 ** 2 * 3", "((-(2**2))*3)"},
+		{"~a ** b", "(~(a**b))"},
+		{"a * b ** c", "(a*(b**c))"},
+		{"a | b ^ c & d", "(a|(b^(c&d)))"},
+		{"1 << 2 + 3", "(1<<(2+3))"},
+		{"a & b == c", "((a&b)==c)"},
+		{"~a & b", "((~a)&b)"},
+		{"a >> 1 && b", "((a>>1)&&b)"},
 		{
 			"!-a",
 			"(!(-a))",
@@ -182,6 +224,25 @@ func TestPriorityOperations(t *testing.T) {
 			"add(a + b + c * d / f + g)",
 			"add((((a+b)+((c*d)/f))+g))",
 		},
+		{
+			"a || b && c",
+			"(a||(b&&c))",
+		},
+		{
+			"a && b || c && d",
+			"((a&&b)||(c&&d))",
+		},
+		{
+			"a == b && c < d || !e",
+			"(((a==b)&&(c<d))||(!e))",
+		},
+		{"1..10", "(1..10)"},
+		{"0..=n - 1", "(0..=(n-1))"},
+		{"a..b step 2 * k", "(a..b step (2*k))"},
+		{"x in 1..5 && y", "((x in (1..5))&&y)"},
+		{"1..5 == r", "((1..5)==r)"},
+		{"0..10 step step", "(0..10 step step)"},
+		{"len(0..n)[i]", "(len((0..n))[i])"},
 	}
 
 	for _, test := range tests {
@@ -349,6 +410,84 @@ func testIntegerLiteral(t *testing.T, integerExpression ast.Expression, expected
 
 }
 
+func TestArrayLiteralParsing(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	l := lexer.New(input)
+	p := New(l)
+	stmts := p.GetStatements()
+
+	testParserErrors(t, p)
+	testStatementsNumber(t, 1, stmts.Statements)
+
+	exprStmt := stmts.Statements[0].(*ast.ExpressionStatement)
+	array, ok := exprStmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("expected *ast.ArrayLiteral got %T instead", exprStmt.Expression)
+	}
+	if len(array.Elements) != 3 {
+		t.Fatalf("expected 3 elements, got %d instead", len(array.Elements))
+	}
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+}
+
+func TestIndexExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedResult string
+	}{
+		{"xs[1 + 1]", "(xs[(1+1)])"},
+		{"a * [1, 2, 3][b * c] * d", "((a*([1, 2, 3][(b*c)]))*d)"},
+		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a*(b[2])), (b[1]), (2*([1, 2][1])))"},
+		{"xs[1:3]", "(xs[1:3])"},
+		{"xs[:n - 1]", "(xs[:(n-1)])"},
+		{"xs[2:]", "(xs[2:])"},
+		{"xs[:]", "(xs[:])"},
+		{"xs[1][0:2]", "((xs[1])[0:2])"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		stmts := p.GetStatements()
+
+		testParserErrors(t, p)
+		testStatementsNumber(t, 1, stmts.Statements)
+
+		if stmts.Statements[0].String() != test.expectedResult {
+			t.Fatalf("expected %s, but got %s instead", test.expectedResult, stmts.Statements[0].String())
+		}
+	}
+}
+
+func TestHashLiteralParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedResult string
+	}{
+		{"{}", "{}"},
+		{`{"one": 1, "two": 2}`, `{"one": 1, "two": 2}`},
+		{`{"a": 1 + 2, b: [1], 3: fn(x) { x; }}`, `{"a": (1+2), b: [1], 3: fn(x)x}`},
+		{`let m = {true: 1,};`, `let m = {true: 1};`},
+		{`if (x) { {1: 2}; }`, `ifx{{1: 2}}else{}`},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		stmts := p.GetStatements()
+
+		testParserErrors(t, p)
+		testStatementsNumber(t, 1, stmts.Statements)
+
+		if stmts.Statements[0].String() != test.expectedResult {
+			t.Fatalf("expected %s, but got %s instead", test.expectedResult, stmts.Statements[0].String())
+		}
+	}
+}
+
 func TestBooleanLiteralExpressions(t *testing.T) {
 	input := "true;"
 
@@ -405,6 +544,87 @@ func TestIntegerLiteralExpressions(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"1e-9;", 1e-9},
+		{"2.5E3;", 2500},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		stmts := p.GetStatements()
+
+		testParserErrors(t, p)
+		testStatementsNumber(t, 1, stmts.Statements)
+
+		exprStmt := stmts.Statements[0].(*ast.ExpressionStatement)
+		float, ok := exprStmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("expected *ast.FloatLiteral got %T instead", exprStmt.Expression)
+		}
+		if float.Value != test.expected {
+			t.Fatalf("expected %v, got %v instead", test.expected, float.Value)
+		}
+	}
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello world";`
+
+	l := lexer.New(input)
+	p := New(l)
+	stmts := p.GetStatements()
+
+	testParserErrors(t, p)
+	testStatementsNumber(t, 1, stmts.Statements)
+
+	exprStmt := stmts.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := exprStmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("expected *ast.StringLiteral got %T instead", exprStmt.Expression)
+	}
+	if literal.Value != "hello world" {
+		t.Fatalf("expected %q, got %q instead", "hello world", literal.Value)
+	}
+}
+
+func TestLexerErrorsReported(t *testing.T) {
+	l := lexer.New(`let s = "abc;`)
+	p := New(l)
+	p.GetStatements()
+
+	if len(p.Errors) == 0 {
+		t.Fatalf("expected errors, got none")
+	}
+	if p.Errors[0] != "unterminated string starting at line 1" {
+		t.Fatalf("expected the lexer error first, got %q instead", p.Errors[0])
+	}
+}
+
+func TestBigIntegerLiteralExpressions(t *testing.T) {
+	input := "123456789012345678901234567890;"
+
+	l := lexer.New(input)
+	p := New(l)
+	stmts := p.GetStatements()
+
+	testParserErrors(t, p)
+	testStatementsNumber(t, 1, stmts.Statements)
+
+	integ, ok := stmts.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("expected IntegerLiteral got %T instead", stmts.Statements[0].(*ast.ExpressionStatement).Expression)
+	}
+	if integ.Big == nil || integ.Big.String() != "123456789012345678901234567890" {
+		t.Fatalf("wrong big integer value, got %v instead", integ.Big)
+	}
+}
+
 func TestIdentExpressions(t *testing.T) {
 	input := "foo;"
 
@@ -464,6 +684,289 @@ func TestWhileStatement(t *testing.T){
 
 }
 
+func TestLoopControlStatements(t *testing.T) {
+	input := "while (x) { if (y) { break; } continue; }"
+	l := lexer.New(input)
+	p := New(l)
+	stmts := p.GetStatements()
+
+	testParserErrors(t, p)
+	testStatementsNumber(t, 1, stmts.Statements)
+
+	whileStmt := stmts.Statements[0].(*ast.WhileStatement)
+	if len(whileStmt.Instructions.Statements) != 2 {
+		t.Fatalf("expected 2 statements in the loop body, got %d", len(whileStmt.Instructions.Statements))
+	}
+	if _, ok := whileStmt.Instructions.Statements[1].(*ast.ContinueStatement); !ok {
+		t.Fatalf("expected *ast.ContinueStatement, got %T instead", whileStmt.Instructions.Statements[1])
+	}
+	ifExpr := whileStmt.Instructions.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if _, ok := ifExpr.Consequences.Statements[0].(*ast.BreakStatement); !ok {
+		t.Fatalf("expected *ast.BreakStatement, got %T instead", ifExpr.Consequences.Statements[0])
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"break;", "'break' outside of a loop at line 1"},
+		{"if (x) { continue; }", "'continue' outside of a loop at line 1"},
+		{"while (x) { fn() { break; }; }", "'break' outside of a loop at line 1"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		p.GetStatements()
+
+		if len(p.Errors) != 1 {
+			t.Fatalf("expected 1 error for %q, got %v", test.input, p.Errors)
+		}
+		if p.Errors[0] != test.expectedError {
+			t.Fatalf("expected error %q, got %q instead", test.expectedError, p.Errors[0])
+		}
+	}
+}
+
+func TestTryStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { f(); } catch (e) { print(e); }", "try{f()}catch(e){print(e);}"},
+		{"try { f(); } finally { g(); };", "try{f()}finally{g()}"},
+		{"try {\n  f();\n}\ncatch (err) { 1 }\nfinally { 2 }", "try{f()}catch(err){1}finally{2}"},
+		{`throw "error";`, `throw "error";`},
+		{"throw x + 1;", "throw (x+1);"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		stmts := p.GetStatements()
+
+		testParserErrors(t, p)
+		testStatementsNumber(t, 1, stmts.Statements)
+
+		if stmts.Statements[0].String() != test.expected {
+			t.Errorf("expected %s, got %s instead", test.expected, stmts.Statements[0].String())
+		}
+	}
+}
+
+func TestTryStatementErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"try { f(); }", "expected 'catch' or 'finally' after the try block at line 1"},
+		{"try { f(); } catch { g(); }", "expected '(', got '{' instead at line 1"},
+		{"try { f(); } catch (1) { g(); }", "expected 'IDENT', got 'INT' instead at line 1"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		p.GetStatements()
+
+		if len(p.Errors) == 0 {
+			t.Fatalf("expected an error for %q", test.input)
+		}
+		if p.Errors[0] != test.expectedError {
+			t.Fatalf("expected error %q, got %q instead", test.expectedError, p.Errors[0])
+		}
+	}
+}
+
+func TestImportStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "lib/math.qfa" as math;`, `import "lib/math.qfa" as math;`},
+		{"m.x", "(m.x)"},
+		{"m.f(1) + 2", "((m.f)(1)+2)"},
+		{"-m.x[0]", "(-((m.x)[0]))"},
+		{"a.b.c", "((a.b).c)"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		stmts := p.GetStatements()
+
+		testParserErrors(t, p)
+		testStatementsNumber(t, 1, stmts.Statements)
+
+		if stmts.Statements[0].String() != test.expected {
+			t.Errorf("expected %s, got %s instead", test.expected, stmts.Statements[0].String())
+		}
+	}
+}
+
+func TestImportStatementErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"import lib as lib;", "expected 'STRING', got 'IDENT' instead at line 1"},
+		{`import "lib.qfa";`, "expected 'AS', got ';' instead at line 1"},
+		{`import "lib.qfa" as 1;`, "expected 'IDENT', got 'INT' instead at line 1"},
+		{"m.1", "expected 'IDENT', got 'INT' instead at line 1"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		p.GetStatements()
+
+		if len(p.Errors) == 0 {
+			t.Fatalf("expected an error for %q", test.input)
+		}
+		if p.Errors[0] != test.expectedError {
+			t.Fatalf("expected error %q, got %q instead", test.expectedError, p.Errors[0])
+		}
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (let i = 0; i < n; i = i + 1) { print(i); }", "for(let i = 0;(i<n);let i = (i+1)){print(i);}"},
+		{"for (i = 0; i < n; i = i + 1) { x }", "for(let i = 0;(i<n);let i = (i+1)){x}"},
+		{"for (f(); ; ) { break; }", "for(f();;){break;}"},
+		{"for (;;) {}", "for(;;){}"},
+		{"for (; x; ) { continue; };", "for(;x;){continue;}"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		stmts := p.GetStatements()
+
+		testParserErrors(t, p)
+		testStatementsNumber(t, 1, stmts.Statements)
+
+		forStmt, ok := stmts.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("stmts.Statements[0] is not *ast.ForStatement, got %T instead", stmts.Statements[0])
+		}
+		if forStmt.String() != test.expected {
+			t.Fatalf("expected %q, got %q instead", test.expected, forStmt.String())
+		}
+	}
+}
+
+func TestForInStatement(t *testing.T) {
+	tests := []struct {
+		input     string
+		variables []string
+		iterable  string
+	}{
+		{"for (x in [1, 2]) { print(x); }", []string{"x"}, "[1, 2]"},
+		{"for (k, v in m) { break; }", []string{"k", "v"}, "m"},
+		{"for (i in len(a)) {}", []string{"i"}, "len(a)"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		stmts := p.GetStatements()
+
+		testParserErrors(t, p)
+		testStatementsNumber(t, 1, stmts.Statements)
+
+		forStmt, ok := stmts.Statements[0].(*ast.ForInStatement)
+		if !ok {
+			t.Fatalf("stmts.Statements[0] is not *ast.ForInStatement, got %T instead", stmts.Statements[0])
+		}
+		if len(forStmt.Variables) != len(test.variables) {
+			t.Fatalf("expected %d variables, got %d instead", len(test.variables), len(forStmt.Variables))
+		}
+		for i, name := range test.variables {
+			testIdentifier(t, forStmt.Variables[i], name)
+		}
+		if forStmt.Iterable.String() != test.iterable {
+			t.Fatalf("expected iterable %q, got %q instead", test.iterable, forStmt.Iterable.String())
+		}
+	}
+}
+
+func TestForStatementErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"for x in a { }", "expected '(', got 'IDENT' instead at line 1"},
+		{"for (x in a { }", "expected ')', got '{' instead at line 1"},
+		{"for (k, 1 in a) { }", "expected 'IDENT', got 'INT' instead at line 1"},
+		{"for (x y) { }", "expected ';', got 'IDENT' instead at line 1"},
+		{"for (let i = 0; i < 3) { }", "expected ';', got ')' instead at line 1"},
+		{"for (;; let i = 0) { }", "unexpected 'let' in the update of a for loop at line 1"},
+		{"for (;;) x", "expected '{', got 'IDENT' instead at line 1"},
+		{"for (x in a) { } break;", "'break' outside of a loop at line 1"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		p.GetStatements()
+
+		if len(p.Errors) == 0 {
+			t.Fatalf("expected an error for %q", test.input)
+		}
+		if p.Errors[0] != test.expectedError {
+			t.Fatalf("expected error %q, got %q instead", test.expectedError, p.Errors[0])
+		}
+	}
+}
+
+func TestMultilineProgram(t *testing.T) {
+	input := `let a = 1;
+let f = fn(x) {
+	return x;
+};
+f(a);
+`
+	l := lexer.New(input)
+	p := New(l)
+	stmts := p.GetStatements()
+
+	testParserErrors(t, p)
+	testStatementsNumber(t, 3, stmts.Statements)
+}
+
+func TestPrintStatement(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedResult string
+	}{
+		{"print();", "print();"},
+		{"print(x)", "print(x);"},
+		{`print("a", 1 + 2, f(x));`, `print("a", (1+2), f(x));`},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		stmts := p.GetStatements()
+
+		testParserErrors(t, p)
+		testStatementsNumber(t, 1, stmts.Statements)
+
+		if _, ok := stmts.Statements[0].(*ast.PrintStatement); !ok {
+			t.Fatalf("expected *ast.PrintStatement got %T instead", stmts.Statements[0])
+		}
+		if stmts.Statements[0].String() != test.expectedResult {
+			t.Fatalf("expected %s, but got %s instead", test.expectedResult, stmts.Statements[0].String())
+		}
+	}
+}
+
 func TestIfStatements(t *testing.T) {
 	tests := []struct {
 		input        string
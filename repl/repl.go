@@ -6,10 +6,13 @@ import (
 	"atomicgo.dev/cursor"
 	"atomicgo.dev/keyboard"
 	"atomicgo.dev/keyboard/keys"
+	"github.com/tysufa/qfa/compiler"
 	"github.com/tysufa/qfa/evaluator"
 	"github.com/tysufa/qfa/lexer"
 	"github.com/tysufa/qfa/object"
+	"github.com/tysufa/qfa/optimizer"
 	"github.com/tysufa/qfa/parser"
+	"github.com/tysufa/qfa/vm"
 )
 
 const PROMPT = ">>> "
@@ -23,8 +26,17 @@ func printInput(input string, pos int) {
 
 }
 
-func Run() {
+// Run starts the repl, engine is "vm" to run the inputs with the bytecode vm
+// and anything else to use the evaluator
+func Run(engine string) {
 	env := object.NewEnvironment()
+	eval := evaluator.New()
+
+	// what the vm keeps from one input to the next
+	symbolTable := compiler.NewSymbolTable()
+	constants := []object.Object{}
+	globals := make([]object.Object, vm.GlobalsSize)
+	modules := make(map[string]*object.Module)
 
 	var input string = ""
 	var inputs []string
@@ -109,12 +121,27 @@ func Run() {
 					fmt.Printf("\n%v\n", err)
 				}
 			} else {
-				evaluated := evaluator.EvaluateProgram(stmts.Statements, env)
-				for _, ev := range evaluated {
-					if ev != nil {
-						fmt.Printf("\n%v", ev.Inspect())
+				fmt.Printf("\n") // what the program prints goes below the input line
+				optimizer.Optimize(&stmts)
+				if engine == "vm" {
+					c := compiler.NewWithState(symbolTable, constants)
+					if err := c.Compile(&stmts); err != nil {
+						fmt.Printf("%v\n", err)
 					} else {
-						fmt.Printf("\n")
+						bytecode := c.Bytecode()
+						constants = bytecode.Constants
+						machine := vm.NewWithGlobalsStore(bytecode, globals)
+						machine.Modules = modules
+						if result := machine.Run(); result != nil {
+							fmt.Printf("%v", result.Inspect())
+						}
+					}
+				} else {
+					evaluated := eval.EvaluateProgram(stmts.Statements, env)
+					for _, ev := range evaluated {
+						if ev != nil {
+							fmt.Printf("%v", ev.Inspect())
+						}
 					}
 				}
 			}
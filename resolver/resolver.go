@@ -0,0 +1,331 @@
+package resolver
+
+import (
+	"github.com/tysufa/qfa/ast"
+	"github.com/tysufa/qfa/object"
+)
+
+// scope matches an environment created when the program runs: the one of a
+// block, or the one of a function call, of a catch block or of an iteration of
+// a for-in loop, which also holds the parameters or the loop variables. A for
+// loop has one more around its body for the variable of its initialization
+type scope struct {
+	slots    map[string]int  // index of every variable declared directly in the scope
+	declared map[string]bool // variables whose declaration was already reached
+	function int             // number of functions the scope is nested in
+	// variable whose let statement is being resolved, its initializer uses
+	// the variable of the same name of an enclosing scope
+	initializing string
+}
+
+type resolver struct {
+	scopes   []*scope
+	function int
+	pending  map[string]bool // globals declared by the program that weren't reached yet
+	globals  Globals
+}
+
+// Globals numbers the globals of the environment a program runs in, such as
+// an object.Environment
+type Globals interface {
+	Index(name string) int    // index of the global name, given the first time it is asked for
+	Defined(name string) bool // whether name exists before the program runs, as in the repl
+}
+
+// NewGlobals numbers the globals for the programs which don't run in an
+// object.Environment, defined tells which globals exist before they run and
+// can be nil
+func NewGlobals(defined func(name string) bool) Globals {
+	return &globals{indexes: make(map[string]int), defined: defined}
+}
+
+type globals struct {
+	indexes map[string]int
+	defined func(name string) bool
+}
+
+func (g *globals) Index(name string) int {
+	index, ok := g.indexes[name]
+	if !ok {
+		index = len(g.indexes)
+		g.indexes[name] = index
+	}
+	return index
+}
+
+func (g *globals) Defined(name string) bool {
+	return g.defined != nil && g.defined(name)
+}
+
+// Resolve gives every identifier of statements the slot of the variable it
+// names, see ast.Identifier, the globals being numbered by globals, or from
+// zero if it is nil. A variable used before its declaration is reported, unless
+// the use is in a function, which can be called later on. The value of a let
+// statement uses the variable of an enclosing scope it shadows
+func Resolve(statements []ast.Statement, globals Globals) *object.Error {
+	if globals == nil {
+		globals = NewGlobals(nil)
+	}
+	r := &resolver{pending: make(map[string]bool), globals: globals}
+	for _, stmt := range statements {
+		if name := declaredName(stmt); name != nil {
+			r.pending[name.Value] = true
+		}
+	}
+	return r.resolveStatements(statements)
+}
+
+// declaredName gives the variable stmt declares, if any
+func declaredName(stmt ast.Statement) *ast.Identifier {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Name
+	case *ast.ImportStatement:
+		return stmt.Name
+	}
+	return nil
+}
+
+func (r *resolver) resolveStatements(statements []ast.Statement) *object.Error {
+	for _, stmt := range statements {
+		if err := r.resolveStatement(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *resolver) resolveStatement(stmt ast.Statement) *object.Error {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		if len(r.scopes) > 0 {
+			s := r.scopes[len(r.scopes)-1]
+			s.initializing = stmt.Name.Value
+			defer func() { s.initializing = "" }()
+		}
+		if err := r.resolveExpression(stmt.Value); err != nil {
+			return err
+		}
+		r.declare(stmt.Name)
+	case *ast.ImportStatement:
+		r.declare(stmt.Name)
+	case *ast.AssignementStatement:
+		if err := r.resolveExpression(stmt.Value); err != nil {
+			return err
+		}
+		return r.resolveIdentifier(stmt.Name)
+	case *ast.ExpressionStatement:
+		return r.resolveExpression(stmt.Expression)
+	case *ast.ReturnStatement:
+		return r.resolveExpression(stmt.Value)
+	case *ast.ThrowStatement:
+		return r.resolveExpression(stmt.Value)
+	case *ast.PrintStatement:
+		return r.resolveExpressions(stmt.Arguments)
+	case *ast.WhileStatement:
+		if err := r.resolveExpression(stmt.Condition); err != nil {
+			return err
+		}
+		return r.resolveBlock(stmt.Instructions)
+	case *ast.ForStatement:
+		// the variable declared by the initialization lives in a scope
+		// enclosing the body
+		r.enterScope([]ast.Statement{stmt.Init}, nil)
+		defer r.leaveScope()
+		if err := r.resolveStatement(stmt.Init); err != nil {
+			return err
+		}
+		if err := r.resolveExpression(stmt.Condition); err != nil {
+			return err
+		}
+		if err := r.resolveStatement(stmt.Update); err != nil {
+			return err
+		}
+		return r.resolveBlock(stmt.Body)
+	case *ast.ForInStatement:
+		if err := r.resolveExpression(stmt.Iterable); err != nil {
+			return err
+		}
+		r.enterScope(stmt.Body.Statements, stmt.Variables)
+		defer r.leaveScope()
+		return r.resolveStatements(stmt.Body.Statements)
+	case *ast.TryStatement:
+		if err := r.resolveBlock(stmt.Body); err != nil {
+			return err
+		}
+		if stmt.Catch != nil {
+			r.enterScope(stmt.Catch.Statements, []*ast.Identifier{stmt.CatchParam})
+			err := r.resolveStatements(stmt.Catch.Statements)
+			r.leaveScope()
+			if err != nil {
+				return err
+			}
+		}
+		return r.resolveBlock(stmt.Finally)
+	}
+	return nil
+}
+
+// resolveBlock resolves block in a scope of its own
+func (r *resolver) resolveBlock(block *ast.BlockStatement) *object.Error {
+	if block == nil {
+		return nil
+	}
+	r.enterScope(block.Statements, nil)
+	defer r.leaveScope()
+	return r.resolveStatements(block.Statements)
+}
+
+func (r *resolver) resolveExpressions(exprs []ast.Expression) *object.Error {
+	for _, expr := range exprs {
+		if err := r.resolveExpression(expr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *resolver) resolveExpression(expr ast.Expression) *object.Error {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		return r.resolveIdentifier(expr)
+	case *ast.InfixExpression:
+		return r.resolveExpressions([]ast.Expression{expr.Left, expr.Right})
+	case *ast.RangeExpression:
+		return r.resolveExpressions([]ast.Expression{expr.Start, expr.End, expr.Step})
+	case *ast.PrefixExpression:
+		return r.resolveExpression(expr.Right)
+	case *ast.IfExpression:
+		if err := r.resolveExpression(expr.Condition); err != nil {
+			return err
+		}
+		if err := r.resolveBlock(expr.Consequences); err != nil {
+			return err
+		}
+		return r.resolveBlock(expr.ElseConsequences)
+	case *ast.FunctionLiteral:
+		r.function++
+		r.enterScope(expr.Body.Statements, expr.Parameters)
+		err := r.resolveStatements(expr.Body.Statements)
+		r.leaveScope()
+		r.function--
+		return err
+	case *ast.CallExpression:
+		if err := r.resolveExpression(expr.Function); err != nil {
+			return err
+		}
+		return r.resolveExpressions(expr.Arguments)
+	case *ast.ArrayLiteral:
+		return r.resolveExpressions(expr.Elements)
+	case *ast.HashLiteral:
+		for i, key := range expr.Keys {
+			if err := r.resolveExpressions([]ast.Expression{key, expr.Values[i]}); err != nil {
+				return err
+			}
+		}
+	case *ast.IndexExpression:
+		return r.resolveExpressions([]ast.Expression{expr.Left, expr.Index})
+	case *ast.MemberExpression:
+		return r.resolveExpression(expr.Left)
+	case *ast.SliceExpression:
+		if err := r.resolveExpression(expr.Left); err != nil {
+			return err
+		}
+		if expr.Start != nil {
+			if err := r.resolveExpression(expr.Start); err != nil {
+				return err
+			}
+		}
+		if expr.End != nil {
+			return r.resolveExpression(expr.End)
+		}
+	}
+	return nil
+}
+
+// resolveIdentifier finds the nearest scope declaring ident, a name no local
+// scope declares is a global
+func (r *resolver) resolveIdentifier(ident *ast.Identifier) *object.Error {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		s := r.scopes[i]
+		index, ok := s.slots[ident.Value]
+		if !ok {
+			continue
+		}
+		if !s.declared[ident.Value] && s.function == r.function {
+			if s.initializing == ident.Value {
+				continue
+			}
+			return usedBeforeDeclaration(ident)
+		}
+		ident.Local = true
+		ident.Depth = len(r.scopes) - 1 - i
+		ident.Index = index
+		return nil
+	}
+
+	ident.Local = false
+	ident.Index = r.globals.Index(ident.Value)
+	if r.function == 0 && r.pending[ident.Value] && !r.isDefined(ident.Value) {
+		return usedBeforeDeclaration(ident)
+	}
+	return nil
+}
+
+func (r *resolver) isDefined(name string) bool {
+	if object.GetBuiltinByName(name) != nil {
+		return true
+	}
+	return r.globals.Defined(name)
+}
+
+// declare marks the variable of a let or import statement as usable from now on
+func (r *resolver) declare(name *ast.Identifier) {
+	if len(r.scopes) == 0 {
+		name.Local = false
+		name.Index = r.globals.Index(name.Value)
+		delete(r.pending, name.Value)
+		return
+	}
+
+	s := r.scopes[len(r.scopes)-1]
+	s.declared[name.Value] = true
+	name.Local = true
+	name.Depth = 0
+	name.Index = s.slots[name.Value]
+}
+
+// enterScope creates the scope of statements, params being already declared in
+// it. A variable declared several times in the same scope has a single slot
+func (r *resolver) enterScope(statements []ast.Statement, params []*ast.Identifier) {
+	s := &scope{slots: make(map[string]int), declared: make(map[string]bool), function: r.function}
+	for _, param := range params {
+		if _, ok := s.slots[param.Value]; !ok {
+			s.slots[param.Value] = len(s.slots)
+		}
+		s.declared[param.Value] = true
+		param.Local = true
+		param.Depth = 0
+		param.Index = s.slots[param.Value]
+	}
+	for _, stmt := range statements {
+		if name := declaredName(stmt); name != nil {
+			if _, ok := s.slots[name.Value]; !ok {
+				s.slots[name.Value] = len(s.slots)
+			}
+		}
+	}
+	r.scopes = append(r.scopes, s)
+}
+
+func (r *resolver) leaveScope() {
+	r.scopes = r.scopes[:len(r.scopes)-1]
+}
+
+func usedBeforeDeclaration(ident *ast.Identifier) *object.Error {
+	err := object.NewError("variable used before its declaration: %s", ident.Value)
+	err.File = ident.Token.File
+	err.Line = ident.Token.Line
+	err.Column = ident.Token.Column
+	return err
+}
@@ -0,0 +1,179 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/tysufa/qfa/ast"
+	"github.com/tysufa/qfa/lexer"
+	"github.com/tysufa/qfa/parser"
+)
+
+func TestSlots(t *testing.T) {
+	program := testResolve(t, `
+let g = 1;
+let f = fn(a, b) {
+	let c = a;
+	if (b) {
+		let d = c;
+		fn() { d + b + g }
+	}
+};`)
+
+	f := program.Statements[1].(*ast.LetStatement)
+	fn := f.Value.(*ast.FunctionLiteral)
+	c := fn.Body.Statements[0].(*ast.LetStatement)
+	ifExpr := fn.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	d := ifExpr.Consequences.Statements[0].(*ast.LetStatement)
+	inner := ifExpr.Consequences.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	sum := inner.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	left := sum.Left.(*ast.InfixExpression)
+
+	tests := []struct {
+		ident         *ast.Identifier
+		expectedLocal bool
+		expectedDepth int
+		expectedIndex int
+	}{
+		{program.Statements[0].(*ast.LetStatement).Name, false, 0, 0},
+		{f.Name, false, 0, 1},
+		{fn.Parameters[0], true, 0, 0},
+		{fn.Parameters[1], true, 0, 1},
+		{c.Name, true, 0, 2},
+		{c.Value.(*ast.Identifier), true, 0, 0},
+		{ifExpr.Condition.(*ast.Identifier), true, 0, 1},
+		{d.Name, true, 0, 0},
+		{d.Value.(*ast.Identifier), true, 1, 2},
+		{left.Left.(*ast.Identifier), true, 1, 0},
+		{left.Right.(*ast.Identifier), true, 2, 1},
+		{sum.Right.(*ast.Identifier), false, 0, 0},
+	}
+
+	for _, tt := range tests {
+		if tt.ident.Local != tt.expectedLocal || tt.ident.Depth != tt.expectedDepth || tt.ident.Index != tt.expectedIndex {
+			t.Errorf("wrong slot for %s at %d:%d. expected=(%v, %d, %d), got=(%v, %d, %d)", tt.ident.Value,
+				tt.ident.Token.Line, tt.ident.Token.Column, tt.expectedLocal, tt.expectedDepth, tt.expectedIndex,
+				tt.ident.Local, tt.ident.Depth, tt.ident.Index)
+		}
+	}
+}
+
+func TestGlobalIndexes(t *testing.T) {
+	globals := NewGlobals(nil)
+	first := parser.New(lexer.New("let a = 1; let b = a;")).GetStatements()
+	second := parser.New(lexer.New("b + a;")).GetStatements()
+	if err := Resolve(first.Statements, globals); err != nil {
+		t.Fatalf("resolver error: %s", err.Message)
+	}
+	if err := Resolve(second.Statements, globals); err != nil {
+		t.Fatalf("resolver error: %s", err.Message)
+	}
+
+	// the programs resolved with the same globals share their indexes
+	sum := second.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	tests := []struct {
+		ident         *ast.Identifier
+		expectedIndex int
+	}{
+		{first.Statements[0].(*ast.LetStatement).Name, 0},
+		{first.Statements[1].(*ast.LetStatement).Name, 1},
+		{first.Statements[1].(*ast.LetStatement).Value.(*ast.Identifier), 0},
+		{sum.Left.(*ast.Identifier), 1},
+		{sum.Right.(*ast.Identifier), 0},
+	}
+	for _, tt := range tests {
+		if tt.ident.Local || tt.ident.Index != tt.expectedIndex {
+			t.Errorf("wrong slot for %s at %d:%d. expected global %d, got=(%v, %d)", tt.ident.Value,
+				tt.ident.Token.Line, tt.ident.Token.Column, tt.expectedIndex, tt.ident.Local, tt.ident.Index)
+		}
+	}
+}
+
+func TestShadowing(t *testing.T) {
+	program := testResolve(t, "let f = fn(c) { if (c) { let c = c + 1; } };")
+
+	fn := program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	ifExpr := fn.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	let := ifExpr.Consequences.Statements[0].(*ast.LetStatement)
+	used := let.Value.(*ast.InfixExpression).Left.(*ast.Identifier)
+
+	if let.Name.Depth != 0 || let.Name.Index != 0 {
+		t.Errorf("wrong slot for the declared c. expected=(0, 0), got=(%d, %d)", let.Name.Depth, let.Name.Index)
+	}
+	if used.Depth != 1 || used.Index != 0 {
+		t.Errorf("wrong slot for the c of the value. expected=(1, 0), got=(%d, %d)", used.Depth, used.Index)
+	}
+}
+
+func TestRedeclaration(t *testing.T) {
+	program := testResolve(t, "fn(x, y, x) { let y = 1; let z = y; let z = 2; }")
+
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	indexes := []int{
+		fn.Parameters[0].Index,
+		fn.Parameters[1].Index,
+		fn.Parameters[2].Index,
+		fn.Body.Statements[0].(*ast.LetStatement).Name.Index,
+		fn.Body.Statements[1].(*ast.LetStatement).Name.Index,
+		fn.Body.Statements[2].(*ast.LetStatement).Name.Index,
+	}
+	expected := []int{0, 1, 0, 1, 2, 2}
+
+	for i, index := range indexes {
+		if index != expected[i] {
+			t.Errorf("wrong indexes. expected=%v, got=%v", expected, indexes)
+			break
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		defined  []string
+		expected string
+	}{
+		{"a; let a = 1;", nil, "a"},
+		{"a; let a = 1;", []string{"a"}, ""},
+		{"len([]); let len = 1;", nil, ""},
+		{"let f = fn() { a }; let a = 1;", nil, ""},
+		{"let f = fn() { let g = fn() { b }; let b = 1; };", nil, ""},
+		{"let f = fn() { b; let b = 1; };", nil, "b"},
+		{"let f = fn(c) { if (c) { c; let c = 1; } };", nil, "c"},
+		{"let f = fn(c) { if (c) { let c = 1; c; } };", nil, ""},
+		{"let f = fn(c) { if (c) { let c = c + 1; } };", nil, ""},
+		{"let x = 1; if (true) { let x = x + 1; }", nil, ""},
+		{`m.x; import "m.qfa" as m;`, nil, "m"},
+		{`let f = fn() { m.x; import "m.qfa" as m; };`, nil, "m"},
+		{`let f = fn() { m.x }; import "m.qfa" as m;`, nil, ""},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).GetStatements()
+		defined := func(name string) bool {
+			for _, d := range tt.defined {
+				if d == name {
+					return true
+				}
+			}
+			return false
+		}
+
+		err := Resolve(program.Statements, NewGlobals(defined))
+		switch {
+		case tt.expected == "" && err != nil:
+			t.Errorf("unexpected error for %q: %s", tt.input, err.Message)
+		case tt.expected != "" && (err == nil || err.Message != "variable used before its declaration: "+tt.expected):
+			t.Errorf("expected %s to be used before its declaration in %q, got %v", tt.expected, tt.input, err)
+		}
+	}
+}
+
+func testResolve(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	program := parser.New(lexer.New(input)).GetStatements()
+	if err := Resolve(program.Statements, nil); err != nil {
+		t.Fatalf("resolver error: %s", err.Message)
+	}
+	return &program
+}
@@ -0,0 +1,114 @@
+// Package testutil holds the checks and fixtures shared by the tests of the
+// evaluator and of the vm, which must give the same results
+package testutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tysufa/qfa/object"
+)
+
+// Integer checks that obj is the Integer res
+func Integer(t *testing.T, obj object.Object, res int) {
+	t.Helper()
+
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T", obj)
+		return
+	}
+	if result.Value != res {
+		t.Errorf("object has wrong value. got=%d, want=%d",
+			result.Value, res)
+	}
+}
+
+// Boolean checks that obj is the Boolean expected
+func Boolean(t *testing.T, obj object.Object, expected bool) {
+	t.Helper()
+
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+	}
+}
+
+// Float checks that obj is the Float expected
+func Float(t *testing.T, obj object.Object, expected float64) {
+	t.Helper()
+
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%v, want=%v", result.Value, expected)
+	}
+}
+
+// Object checks obj against expected: an int or a bool for an Integer or a
+// Boolean, nil for NULL, and a string for a String or the message of an Error
+func Object(t *testing.T, obj object.Object, expected interface{}) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		Integer(t, obj, expected)
+	case bool:
+		Boolean(t, obj, expected)
+	case nil:
+		if obj != object.NULL {
+			t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+		}
+	case string:
+		switch obj := obj.(type) {
+		case *object.String:
+			if obj.Value != expected {
+				t.Errorf("String has wrong value. expected=%q, got=%q", expected, obj.Value)
+			}
+		case *object.Error:
+			if obj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, obj.Message)
+			}
+		default:
+			t.Errorf("object is neither String nor Error. got=%T (%+v)", obj, obj)
+		}
+	}
+}
+
+// ImportFiles writes the modules imported by the tests in a temporary
+// directory, with its path/ directory as QFA_PATH, and gives the path of the
+// main file importing them
+func ImportFiles(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib/util.qfa":    "let double = fn(x) { x * 2 };\nlet count = 0;\nlet inc = fn() { count = count + 1; count };",
+		"lib/nested.qfa":  `import "util.qfa" as util; let quadruple = fn(x) { util.double(util.double(x)) };`,
+		"lib/cycle_a.qfa": `import "cycle_b.qfa" as b;`,
+		"lib/cycle_b.qfa": `import "cycle_a.qfa" as a;`,
+		"lib/failing.qfa": "let x = 1;\nlet y = x / 0;",
+		"lib/invalid.qfa": "let x = ;",
+		"path/found.qfa":  "let value = 5;",
+		"main.qfa":        `import "main.qfa" as main;`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("QFA_PATH", filepath.Join(dir, "path"))
+	return filepath.Join(dir, "main.qfa")
+}
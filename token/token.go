@@ -8,10 +8,24 @@ const (
 	MINUS     = "-"
 	SLASH     = "/"
 	STAR      = "*"
+	PERCENT   = "%"
+	POWER     = "**"
+	BIT_AND   = "&"
+	BIT_OR    = "|"
+	BIT_XOR   = "^"
+	BIT_NOT   = "~"
+	LSHIFT    = "<<"
+	RSHIFT    = ">>"
 	LPAR      = "("
 	RPAR      = ")"
 	LBR       = "{"
 	RBR       = "}"
+	LBRACKET  = "["
+	RBRACKET  = "]"
+	COLON     = ":"
+	DOT       = "."
+	DOTDOT    = ".."
+	DOTDOTEQ  = "..="
 	EQ        = "="
 	GT        = ">"
 	LT        = "<"
@@ -19,14 +33,27 @@ const (
 	LEQT      = "<="
 	EQEQ      = "=="
 	NEQ       = "!="
+	AND       = "&&"
+	OR        = "||"
 	IDENT     = "IDENT"
 	INT       = "INT"
 	FLOAT     = "FLOAT"
+	STRING    = "STRING"
 	IF        = "IF"
 	ELSE      = "ELSE"
 	FN        = "FN"
 	WHILE     = "WHILE"
+	FOR       = "FOR"
+	IN        = "IN"
+	BREAK     = "BREAK"
+	CONTINUE  = "CONTINUE"
 	PRINT     = "PRINT"
+	TRY       = "TRY"
+	CATCH     = "CATCH"
+	FINALLY   = "FINALLY"
+	THROW     = "THROW"
+	IMPORT    = "IMPORT"
+	AS        = "AS"
 	RETURN    = "RETURN"
 	TRUE      = "TRUE"
 	FALSE     = "FALSE"
@@ -39,19 +66,31 @@ const (
 )
 
 var Reserved = map[string]TokenType{
-	"fn":     FN,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
-	"true":   TRUE,
-	"false":  FALSE,
-	"let":    LET,
-	"while":  WHILE,
-	"print":  PRINT,
+	"fn":       FN,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"true":     TRUE,
+	"false":    FALSE,
+	"let":      LET,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"print":    PRINT,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
+	"throw":    THROW,
+	"import":   IMPORT,
+	"as":       AS,
 }
 
 type Token struct {
-	Value string
-	Type  TokenType
-	Line  int
+	Value  string
+	Type   TokenType
+	File   string // name of the source file, empty when the input doesn't come from a file
+	Line   int
+	Column int // counted in characters from 1
 }
@@ -0,0 +1,34 @@
+package vm
+
+import (
+	"github.com/tysufa/qfa/code"
+	"github.com/tysufa/qfa/object"
+	"github.com/tysufa/qfa/token"
+)
+
+// Frame is a call of a function being run, the main program has the outermost one
+type Frame struct {
+	cl          *object.Closure
+	ip          int            // offset of the next instruction
+	basePointer int            // height of the stack when the function was called
+	scope       *object.Scope  // innermost scope of the code being run
+	call        token.Token    // where the function was called
+	module      *object.Module // set when running the top level code of an imported file
+}
+
+func NewFrame(cl *object.Closure, basePointer int, scope *object.Scope, call token.Token) *Frame {
+	return &Frame{cl: cl, basePointer: basePointer, scope: scope, call: call}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
+
+// handler is set up by OpTry: an error raised before the matching OpEndTry
+// unwinds the vm to the state it had then and jumps to ip
+type handler struct {
+	frame int // index of the frame that set it up
+	sp    int
+	scope *object.Scope
+	ip    int
+}
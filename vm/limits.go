@@ -0,0 +1,19 @@
+package vm
+
+import (
+	"context"
+
+	"github.com/tysufa/qfa/object"
+)
+
+// Limits bounds the resources a program can use, see object.Limits
+type Limits = object.Limits
+
+// RunContext runs the program like Run, stopping as soon as ctx is done or
+// one of vm.Limits is exceeded
+func (vm *VM) RunContext(ctx context.Context) object.Object {
+	vm.usage.Start(ctx, vm.Limits)
+	defer vm.usage.Stop()
+
+	return vm.run()
+}
@@ -0,0 +1,78 @@
+package vm
+
+import (
+	"github.com/tysufa/qfa/compiler"
+	"github.com/tysufa/qfa/module"
+	"github.com/tysufa/qfa/object"
+)
+
+// importModule pushes the module imported as name by the instruction at ip: a
+// standard module, or the one of a file. The first time, the file is compiled and its top level
+// code gets a frame of its own, returning from which pushes the module
+func (vm *VM) importModule(name string, ip int) *object.Error {
+	if mod := object.GetStandardModule(name); mod != nil {
+		vm.push(mod)
+		return nil
+	}
+	importer := vm.frames[len(vm.frames)-1].cl.Fn.TokenAt(ip)
+	path, err := module.Find(name, importer.File)
+	if err != nil {
+		return object.NewError("%v", err)
+	}
+	if mod, ok := vm.Modules[path]; ok {
+		vm.push(mod)
+		return nil
+	}
+
+	loading := []*object.Module{}
+	for _, frame := range vm.frames {
+		if frame.module != nil {
+			loading = append(loading, frame.module)
+		}
+	}
+	if cycle := module.Cycle(vm.main.Fn.TokenAt(0).File, loading, path, name); cycle != "" {
+		return object.NewError("import cycle: %s", cycle)
+	}
+
+	program, err := module.Load(path)
+	if err != nil {
+		return object.NewError("error in module %s: %v", name, err)
+	}
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		return object.NewError("error in module %s: %v", name, err)
+	}
+
+	bytecode := c.Bytecode()
+	fn := &object.CompiledFunction{Instructions: bytecode.Instructions, Positions: bytecode.Positions}
+	file := &object.CompiledFile{
+		Constants:   bytecode.Constants,
+		Globals:     make([]object.Object, len(bytecode.GlobalNames)),
+		GlobalNames: bytecode.GlobalNames,
+	}
+	indexes := make(map[string]int, len(file.GlobalNames))
+	for i, name := range file.GlobalNames {
+		indexes[name] = i
+	}
+	mod := &object.Module{Name: name, Path: path, Get: func(name string) (object.Object, bool) {
+		i, ok := indexes[name]
+		if !ok || file.Globals[i] == nil {
+			return nil, false
+		}
+		return file.Globals[i], true
+	}}
+
+	frame := NewFrame(&object.Closure{Fn: fn, File: file}, vm.sp, nil, importer)
+	frame.module = mod
+	vm.frames = append(vm.frames, frame)
+	return nil
+}
+
+// loaded records that the file of mod ran to its end
+func (vm *VM) loaded(mod *object.Module) *object.Module {
+	if vm.Modules == nil {
+		vm.Modules = make(map[string]*object.Module)
+	}
+	vm.Modules[mod.Path] = mod
+	return mod
+}
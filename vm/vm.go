@@ -0,0 +1,489 @@
+package vm
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/tysufa/qfa/code"
+	"github.com/tysufa/qfa/compiler"
+	"github.com/tysufa/qfa/object"
+	"github.com/tysufa/qfa/token"
+)
+
+// StackSize is the initial size of the stack, it grows as needed
+const StackSize = 2048
+
+// GlobalsSize is the number of globals the operands of the instructions can address
+const GlobalsSize = 65536
+
+// DefaultMaxCallDepth is the number of nested function calls allowed by New
+const DefaultMaxCallDepth = object.DefaultMaxCallDepth
+
+var (
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+)
+
+var infixOperators = [...]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpPow:          "**",
+	code.OpBitAnd:       "&",
+	code.OpBitOr:        "|",
+	code.OpBitXor:       "^",
+	code.OpShiftLeft:    "<<",
+	code.OpShiftRight:   ">>",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpGreaterThan:  ">",
+	code.OpGreaterEqual: ">=",
+	code.OpLessThan:     "<",
+	code.OpLessEqual:    "<=",
+	code.OpIn:           "in",
+}
+
+// testedOperands describes the operands checked by OpTest in the errors of the
+// strict truthiness
+var testedOperands = []string{
+	code.TestAnd: "operand of &&",
+	code.TestOr:  "operand of ||",
+}
+
+// VM runs the bytecode of a program, it gives the same results as the evaluator
+type VM struct {
+	Output       io.Writer                 // where print writes, os.Stdout by default
+	Truthiness   object.Truthiness         // Lenient by default
+	MaxCallDepth int                       // nested calls allowed before a stack overflow error, 0 for no limit
+	Limits       Limits                    // no limit by default
+	Modules      map[string]*object.Module // imported files by absolute path, vms sharing it import a file once
+
+	main *object.Closure // its file holds the globals, nil for the ones not defined yet
+
+	stack    []object.Object
+	sp       int // the top of the stack is stack[sp-1]
+	frames   []*Frame
+	handlers []handler
+
+	usage object.Usage // of the program being run, checked against Limits
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobalsStore(bytecode, make([]object.Object, GlobalsSize))
+}
+
+// NewWithGlobalsStore creates a vm using globals to store the globals, so that
+// they outlive it, as needed by the repl
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, globals []object.Object) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, Positions: bytecode.Positions}
+	file := &object.CompiledFile{Constants: bytecode.Constants, Globals: globals, GlobalNames: bytecode.GlobalNames}
+
+	return &VM{
+		Output:       os.Stdout,
+		MaxCallDepth: DefaultMaxCallDepth,
+		main:         &object.Closure{Fn: mainFn, File: file},
+		stack:        make([]object.Object, 0, StackSize),
+	}
+}
+
+// Run runs the program and returns the value of its last statement, nil if it
+// isn't an expression, or the error that stopped it. A Go panic caused by a bug
+// of the vm doesn't crash the host, it ends the program with an internal error
+func (vm *VM) Run() object.Object {
+	return vm.RunContext(context.Background())
+}
+
+func (vm *VM) run() (result object.Object) {
+	vm.frames = []*Frame{NewFrame(vm.main, 0, nil, token.Token{})}
+	vm.sp = 0
+	vm.handlers = nil
+
+	defer func() {
+		if r := recover(); r != nil {
+			result = object.NewError("internal error: %v", r)
+		}
+	}()
+
+	for {
+		frame := vm.frames[len(vm.frames)-1]
+		ins := frame.Instructions()
+		ip := frame.ip
+		op := code.Opcode(ins[ip])
+		frame.ip++
+
+		if err := vm.usage.Step(); err != nil {
+			return vm.raise(err, ip)
+		}
+
+		var err *object.Error
+		switch op {
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpPow, code.OpBitAnd, code.OpBitOr, code.OpBitXor,
+			code.OpShiftLeft, code.OpShiftRight, code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterEqual,
+			code.OpLessThan, code.OpLessEqual, code.OpIn:
+			right := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(vm.usage.Allocate(object.InfixOperator(infixOperators[op], left, right)))
+		case code.OpConstant:
+			index := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			err = vm.pushResult(vm.usage.Allocate(frame.cl.File.Constants[index]))
+		case code.OpPop:
+			vm.pop()
+		case code.OpTrue:
+			vm.push(TRUE)
+		case code.OpFalse:
+			vm.push(FALSE)
+		case code.OpNull:
+			vm.push(NULL)
+
+		case code.OpMinus:
+			err = vm.pushResult(vm.usage.Allocate(object.PrefixOperator("-", vm.pop())))
+		case code.OpBitNot:
+			err = vm.pushResult(vm.usage.Allocate(object.PrefixOperator("~", vm.pop())))
+		case code.OpNot:
+			var truthy bool
+			if truthy, err = object.Truthy(vm.pop(), vm.Truthiness, "operand of !"); err == nil {
+				vm.push(object.BoolObject(!truthy))
+			}
+		case code.OpTest:
+			what := testedOperands[ins[ip+1]]
+			frame.ip++
+			var truthy bool
+			if truthy, err = object.Truthy(vm.pop(), vm.Truthiness, what); err == nil {
+				vm.push(object.BoolObject(truthy))
+			}
+
+		case code.OpJump:
+			frame.ip = int(code.ReadUint16(ins[ip+1:]))
+		case code.OpJumpNotTruthy:
+			frame.ip += 2
+			var truthy bool
+			if truthy, err = object.Truthy(vm.pop(), vm.Truthiness, "condition"); err == nil && !truthy {
+				frame.ip = int(code.ReadUint16(ins[ip+1:]))
+			}
+
+		case code.OpGetGlobal:
+			index := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			err = vm.pushResult(getGlobal(frame.cl.File, int(index)))
+		case code.OpDefineGlobal:
+			index := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			frame.cl.File.Globals[index] = vm.pop()
+		case code.OpSetGlobal:
+			index := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			val := vm.pop()
+			if globals := frame.cl.File.Globals; globals[index] == nil {
+				err = object.NewError("assignment to undeclared variable: %s", frame.cl.File.GlobalNames[index])
+			} else {
+				globals[index] = val
+			}
+		case code.OpGetLocal:
+			scope := outerScope(frame.scope, int(ins[ip+1]))
+			frame.ip += 3
+			if val := scope.Slots[code.ReadUint16(ins[ip+2:])]; val != nil {
+				vm.push(val)
+			} else {
+				// a function using a variable of an enclosing scope declared
+				// after it was called before the declaration
+				err = object.NewError("identifier not found: %s", frame.cl.Fn.TokenAt(ip).Value)
+			}
+		case code.OpSetLocal:
+			scope := outerScope(frame.scope, int(ins[ip+1]))
+			scope.Slots[code.ReadUint16(ins[ip+2:])] = vm.pop()
+			frame.ip += 3
+		case code.OpEnterScope:
+			size := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			frame.scope = &object.Scope{Slots: make([]object.Object, size), Outer: frame.scope}
+		case code.OpLeaveScope:
+			frame.scope = frame.scope.Outer
+
+		case code.OpArray:
+			size := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			elements := make([]object.Object, size)
+			copy(elements, vm.stack[vm.sp-size:vm.sp])
+			vm.sp -= size
+			err = vm.pushResult(vm.usage.Allocate(&object.Array{Elements: elements}))
+		case code.OpHash:
+			size := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			err = vm.pushResult(vm.usage.Allocate(vm.buildHash(size)))
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(object.Index(left, index))
+		case code.OpSlice:
+			bounds := ins[ip+1]
+			frame.ip++
+			var start, end object.Object
+			if bounds&code.SliceEnd != 0 {
+				end = vm.pop()
+			}
+			if bounds&code.SliceStart != 0 {
+				start = vm.pop()
+			}
+			left := vm.pop()
+			err = vm.pushResult(vm.usage.Allocate(object.Slice(left, start, end)))
+		case code.OpRange:
+			flags := ins[ip+1]
+			frame.ip++
+			var step object.Object = &object.Integer{Value: 1}
+			if flags&code.RangeStep != 0 {
+				step = vm.pop()
+			}
+			end := vm.pop()
+			start := vm.pop()
+			err = vm.pushResult(vm.usage.Allocate(object.NewRange(start, end, step, flags&code.RangeInclusive != 0)))
+
+		case code.OpClosure:
+			index := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			fn := frame.cl.File.Constants[index].(*object.CompiledFunction)
+			err = vm.pushResult(vm.usage.Allocate(&object.Closure{Fn: fn, Scope: frame.scope, File: frame.cl.File}))
+		case code.OpCall, code.OpTailCall:
+			numArgs := int(ins[ip+1])
+			frame.ip++
+			err = vm.call(numArgs, ip, op == code.OpTailCall)
+		case code.OpReturnValue, code.OpReturn:
+			var value object.Object = NULL
+			if op == code.OpReturnValue {
+				value = vm.pop()
+			}
+			if len(vm.frames) == 1 {
+				if op == code.OpReturn {
+					return nil
+				}
+				return value
+			}
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			vm.sp = frame.basePointer
+			if frame.module != nil {
+				// the file imported ran to its end, the value of its last
+				// statement is dropped for its module
+				value = vm.loaded(frame.module)
+			}
+			vm.push(value)
+			vm.dropHandlers()
+
+		case code.OpPrint:
+			numArgs := int(ins[ip+1])
+			frame.ip++
+			err = object.Print(vm.Output, vm.stack[vm.sp-numArgs:vm.sp])
+			vm.sp -= numArgs
+
+		case code.OpThrow:
+			err = object.ThrownError(vm.pop())
+		case code.OpTry:
+			frame.ip += 2
+			vm.handlers = append(vm.handlers, handler{
+				frame: len(vm.frames) - 1,
+				sp:    vm.sp,
+				scope: frame.scope,
+				ip:    int(code.ReadUint16(ins[ip+1:])),
+			})
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case code.OpCatch:
+			vm.push(object.ErrorToHash(vm.pop().(*object.Error)))
+		case code.OpRethrow:
+			err = vm.pop().(*object.Error)
+
+		case code.OpImport:
+			index := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			err = vm.importModule(frame.cl.File.Constants[index].(*object.String).Value, ip)
+		case code.OpMember:
+			index := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			err = vm.pushResult(object.Member(vm.pop(), frame.cl.File.Constants[index].(*object.String).Value))
+
+		case code.OpIter:
+			var it *object.Iterator
+			if it, err = object.Iterate(vm.pop()); err == nil {
+				vm.push(it)
+			}
+		case code.OpIterNext:
+			count := int(ins[ip+3])
+			frame.ip += 3
+			it := vm.stack[vm.sp-1].(*object.Iterator)
+			key, value, ok := it.Next()
+			switch {
+			case !ok:
+				frame.ip = int(code.ReadUint16(ins[ip+1:]))
+			case count == 1:
+				vm.push(it.Element(key, value))
+			default:
+				vm.push(key)
+				vm.push(value)
+			}
+		}
+
+		if err != nil {
+			if err = vm.raise(err, ip); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// call calls the function below the numArgs arguments on top of the stack. A
+// tail call replaces the frame of the current function instead of adding one
+func (vm *VM) call(numArgs int, ip int, tail bool) *object.Error {
+	frame := vm.frames[len(vm.frames)-1]
+
+	switch callee := vm.stack[vm.sp-1-numArgs].(type) {
+	case *object.Builtin:
+		args := make([]object.Object, numArgs)
+		copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+		vm.sp -= numArgs + 1
+
+		result := callee.Call(vm.usage.Budget, args...)
+		if result == nil {
+			result = NULL
+		}
+		return vm.pushResult(vm.usage.Allocate(result))
+
+	case *object.Closure:
+		if numArgs != callee.Fn.NumParameters {
+			return object.NewError("wrong number of arguments: expected %d, got %d", callee.Fn.NumParameters, numArgs)
+		}
+		if !tail && vm.MaxCallDepth > 0 && len(vm.frames)-1 >= vm.MaxCallDepth {
+			return object.NewError("stack overflow: more than %d nested calls", vm.MaxCallDepth)
+		}
+
+		scope := &object.Scope{Slots: make([]object.Object, callee.Fn.NumLocals), Outer: callee.Scope}
+		copy(scope.Slots, vm.stack[vm.sp-numArgs:vm.sp])
+		call := frame.cl.Fn.TokenAt(ip)
+
+		if tail {
+			vm.sp = frame.basePointer
+			vm.frames[len(vm.frames)-1] = NewFrame(callee, frame.basePointer, scope, call)
+		} else {
+			vm.sp -= numArgs + 1
+			vm.frames = append(vm.frames, NewFrame(callee, vm.sp, scope, call))
+		}
+		return nil
+	}
+
+	return object.NewError("not a function: %s", vm.stack[vm.sp-1-numArgs].Type())
+}
+
+// raise hands err to the innermost handler, it returns err if there is none or
+// if err can't be caught
+func (vm *VM) raise(err *object.Error, ip int) *object.Error {
+	if err.Line == 0 {
+		vm.locate(err, ip)
+	}
+	if err.Fatal || len(vm.handlers) == 0 {
+		return err
+	}
+
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	vm.frames = vm.frames[:h.frame+1]
+
+	frame := vm.frames[h.frame]
+	frame.ip = h.ip
+	frame.scope = h.scope
+	vm.sp = h.sp
+	vm.push(err)
+	return nil
+}
+
+// locate records in err the position of the instruction at ip in the current
+// function and the functions being called
+func (vm *VM) locate(err *object.Error, ip int) {
+	tok := vm.frames[len(vm.frames)-1].cl.Fn.TokenAt(ip)
+	err.File = tok.File
+	err.Line = tok.Line
+	err.Column = tok.Column
+	err.Stack = make([]object.Frame, 0, len(vm.frames)-1)
+	for i := len(vm.frames) - 1; i > 0; i-- {
+		frame := vm.frames[i]
+		if frame.module != nil {
+			// the calls made before the import aren't part of the file imported
+			break
+		}
+		err.Stack = append(err.Stack, object.Frame{
+			Function: frame.cl.Fn.Name,
+			File:     frame.call.File,
+			Line:     frame.call.Line,
+			Column:   frame.call.Column,
+		})
+	}
+}
+
+// dropHandlers removes the handlers of the frames that returned
+func (vm *VM) dropHandlers() {
+	for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].frame >= len(vm.frames) {
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	}
+}
+
+// getGlobal returns the global of file at index, falling back to the builtin
+// of the same name when it isn't defined
+func getGlobal(file *object.CompiledFile, index int) object.Object {
+	if val := file.Globals[index]; val != nil {
+		return val
+	}
+	name := file.GlobalNames[index]
+	if builtin := object.GetBuiltinByName(name); builtin != nil {
+		return builtin
+	}
+	return object.NewError("identifier not found: %s", name)
+}
+
+// buildHash pops the size key and value pairs on top of the stack into a hash
+func (vm *VM) buildHash(size int) object.Object {
+	hash := object.NewHash()
+	start := vm.sp - 2*size
+	defer func() { vm.sp = start }()
+
+	for i := start; i < vm.sp; i += 2 {
+		key, ok := vm.stack[i].(object.Hashable)
+		if !ok {
+			return object.NewError("unusable as hash key: %s", vm.stack[i].Type())
+		}
+		hash.Set(key, vm.stack[i+1])
+	}
+	return hash
+}
+
+// pushResult pushes the result of an operation, unless it is an error which
+// is returned instead
+func (vm *VM) pushResult(obj object.Object) *object.Error {
+	if err, ok := obj.(*object.Error); ok {
+		return err
+	}
+	vm.push(obj)
+	return nil
+}
+
+func (vm *VM) push(obj object.Object) {
+	if vm.sp < len(vm.stack) {
+		vm.stack[vm.sp] = obj
+	} else {
+		vm.stack = append(vm.stack, obj)
+	}
+	vm.sp++
+}
+
+func (vm *VM) pop() object.Object {
+	vm.sp--
+	return vm.stack[vm.sp]
+}
+
+// outerScope returns the scope depth levels above scope
+func outerScope(scope *object.Scope, depth int) *object.Scope {
+	for ; depth > 0; depth-- {
+		scope = scope.Outer
+	}
+	return scope
+}